@@ -0,0 +1,209 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Verdict is the outcome of checking a typed answer.
+type Verdict int
+
+const (
+	VerdictWrong Verdict = iota
+	VerdictNearMiss
+	// VerdictAccents is an answer that is only wrong in its accents and
+	// other diacritics, in a deck that warns about them.
+	VerdictAccents
+	VerdictCorrect
+)
+
+// AnswerChecker compares the answer a user typed with the answer of a card.
+type AnswerChecker interface {
+	Check(userAnswer string, answer string) Verdict
+}
+
+// ExactChecker only accepts answers that differ in case or surrounding space.
+type ExactChecker struct{}
+
+func (ExactChecker) Check(userAnswer string, answer string) Verdict {
+	if IsAnswerCorrectInLowerCase(userAnswer, answer) {
+		return VerdictCorrect
+	}
+	return VerdictWrong
+}
+
+// TypoChecker calls an answer a near miss if it is at most Tolerance edits
+// away from the correct one. So that short words don't turn into other words,
+// the edits may touch at most a quarter of the answer's characters.
+type TypoChecker struct {
+	Tolerance int
+}
+
+func (c TypoChecker) Check(userAnswer string, answer string) Verdict {
+	if IsAnswerCorrectInLowerCase(userAnswer, answer) {
+		return VerdictCorrect
+	}
+	userAnswer = strings.ToLower(strings.TrimSpace(userAnswer))
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	distance := editDistance(userAnswer, answer)
+	if distance <= c.Tolerance && distance*4 <= utf8.RuneCountInString(answer) {
+		return VerdictNearMiss
+	}
+	return VerdictWrong
+}
+
+// diacriticModes are how strict a deck is about accents and other
+// diacritics: ignore them, accept answers without them with a warning, or
+// require them.
+var diacriticModes = []string{"ignore", "warn", "require"}
+
+// DiacriticChecker compares answers in Unicode normal form C, so that an
+// accent typed as a separate combining character still matches. Answers that
+// only miss diacritics count as correct if Mode is "ignore", as
+// VerdictAccents if it is "warn" and as wrong if it is "require", however
+// lenient Checker is about typos.
+type DiacriticChecker struct {
+	Mode    string
+	Checker AnswerChecker
+}
+
+func (c DiacriticChecker) Check(userAnswer string, answer string) Verdict {
+	userAnswer, answer = norm.NFC.String(userAnswer), norm.NFC.String(answer)
+	verdict := c.Checker.Check(userAnswer, answer)
+	if verdict == VerdictCorrect {
+		return verdict
+	}
+	if c.Checker.Check(removeDiacritics(userAnswer), removeDiacritics(answer)) != VerdictCorrect {
+		return verdict
+	}
+	switch c.Mode {
+	case "ignore":
+		return VerdictCorrect
+	case "require":
+		return VerdictWrong
+	}
+	return VerdictAccents
+}
+
+// removeDiacritics turns "está" into "esta". It splits every character into
+// its base and combining marks (normal form D) and drops the marks.
+func removeDiacritics(value string) string {
+	plain, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), value)
+	if err != nil {
+		return value
+	}
+	return plain
+}
+
+// answerCheckerFor returns the checker for the typed answers of a deck. A
+// typo tolerance of 0 only accepts exact answers.
+func answerCheckerFor(deck Deck) AnswerChecker {
+	var checker AnswerChecker = ExactChecker{}
+	if deck.TypoTolerance > 0 {
+		checker = TypoChecker{Tolerance: int(deck.TypoTolerance)}
+	}
+	return DiacriticChecker{Mode: deck.DiacriticMode, Checker: checker}
+}
+
+// accentsMessage tells the user that an answer was accepted without the
+// diacritics of the correct answer.
+func accentsMessage(answer string) string {
+	return "Correct, but mind the accents: " + answer
+}
+
+// answerSeparator separates the accepted answers of a card, as in
+// "auto; coche; carro".
+const answerSeparator = ";"
+
+// parseAnswers reads the accepted answers of a card from one or more form
+// values, each of which can hold several answers separated by semicolons.
+// Empty answers and answers that only differ in case are dropped.
+func parseAnswers(values []string) []string {
+	var answers []string
+	for _, value := range values {
+		for _, answer := range strings.Split(value, answerSeparator) {
+			answer = strings.TrimSpace(answer)
+			if answer == "" || slices.ContainsFunc(answers, func(a string) bool { return strings.EqualFold(a, answer) }) {
+				continue
+			}
+			answers = append(answers, answer)
+		}
+	}
+	return answers
+}
+
+// joinAnswers is the counterpart of parseAnswers, it is how Card.Answer holds
+// several answers.
+func joinAnswers(answers []string) string {
+	return strings.Join(answers, answerSeparator+" ")
+}
+
+// Answers returns the accepted answers of the card.
+func (c Card) Answers() []string {
+	return parseAnswers([]string{c.Answer})
+}
+
+// checkAnswers checks a typed answer against every accepted answer and
+// returns the best verdict along with the answer that got it.
+func checkAnswers(checker AnswerChecker, userAnswer string, answers []string) (Verdict, string) {
+	best, matched := VerdictWrong, ""
+	for _, answer := range answers {
+		verdict := checker.Check(userAnswer, answer)
+		if verdict > best || matched == "" {
+			best, matched = verdict, answer
+		}
+	}
+	return best, matched
+}
+
+// nearMissPolicies are what a deck can do with a near miss: count it as
+// correct, let the user try again or count it as a hard answer.
+var nearMissPolicies = []string{"correct", "retry", "hard"}
+
+// nearMissGrade returns the grade a near miss gets in a deck. It returns
+// false if the user should try again instead.
+func nearMissGrade(deck Deck) (Grade, bool) {
+	switch deck.NearMissPolicy {
+	case "correct":
+		return GradeGood, true
+	case "hard":
+		return GradeHard, true
+	}
+	return GradeAgain, false
+}
+
+// editDistance is the number of inserted, deleted, substituted or swapped
+// neighbouring characters it takes to turn a into b. Swaps count as one edit,
+// so "recieve" is a single edit away from "receive".
+func editDistance(a string, b string) int {
+	s, t := []rune(a), []rune(b)
+	// rows of the distance matrix for the two previous and the current prefix of s
+	previous2 := make([]int, len(t)+1)
+	previous := make([]int, len(t)+1)
+	current := make([]int, len(t)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		current[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				current[j] = min(current[j], previous2[j-2]+1)
+			}
+		}
+		previous2, previous, current = previous, current, previous2
+	}
+	return previous[len(t)]
+}
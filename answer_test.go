@@ -0,0 +1,126 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"receive", "receive", 0},
+		{"recieve", "receive", 1},
+		{"recive", "receive", 1},
+		{"receeve", "receive", 1},
+		{"kitten", "sitting", 3},
+		{"está", "esta", 1},
+	}
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestTypoChecker(t *testing.T) {
+	checker := TypoChecker{Tolerance: 2}
+	tests := []struct {
+		userAnswer, answer string
+		want               Verdict
+	}{
+		{" Receive ", "receive", VerdictCorrect},
+		{"recieve", "receive", VerdictNearMiss},
+		{"recive", "receive", VerdictNearMiss},
+		{"rcve", "receive", VerdictWrong},
+		{"it", "is", VerdictWrong},
+		{"dog", "cat", VerdictWrong},
+	}
+	for _, test := range tests {
+		if got := checker.Check(test.userAnswer, test.answer); got != test.want {
+			t.Errorf("Check(%q, %q) = %d, want %d", test.userAnswer, test.answer, got, test.want)
+		}
+	}
+
+	if got := (ExactChecker{}).Check("recieve", "receive"); got != VerdictWrong {
+		t.Errorf("ExactChecker accepted a typo")
+	}
+}
+
+func TestDiacriticChecker(t *testing.T) {
+	tests := []struct {
+		mode, userAnswer, answer string
+		want                     Verdict
+	}{
+		{"require", "está", "está", VerdictCorrect},
+		// an accent typed as a combining character
+		{"require", "esté", "esté", VerdictCorrect},
+		{"require", "esta", "está", VerdictWrong},
+		{"warn", "esta", "está", VerdictAccents},
+		{"warn", "Tiếng Việt", "tiếng việt", VerdictCorrect},
+		{"warn", "tieng viet", "tiếng việt", VerdictAccents},
+		{"ignore", "esta", "está", VerdictCorrect},
+		{"ignore", "este", "esta", VerdictWrong},
+	}
+	for _, test := range tests {
+		checker := DiacriticChecker{Mode: test.mode, Checker: ExactChecker{}}
+		if got := checker.Check(test.userAnswer, test.answer); got != test.want {
+			t.Errorf("%s: Check(%q, %q) = %d, want %d", test.mode, test.userAnswer, test.answer, got, test.want)
+		}
+	}
+}
+
+func TestRequiredDiacriticsAreNoTypo(t *testing.T) {
+	deck := Deck{DiacriticMode: "require", TypoTolerance: 1, NearMissPolicy: "correct"}
+	checker := answerCheckerFor(deck)
+	if got := checker.Check("esta", "está"); got != VerdictWrong {
+		t.Errorf("missing accent = %d, want VerdictWrong", got)
+	}
+	// other typos are still near misses
+	if got := checker.Check("estás", "estáis"); got != VerdictNearMiss {
+		t.Errorf("typo = %d, want VerdictNearMiss", got)
+	}
+}
+
+func TestRemoveDiacritics(t *testing.T) {
+	if got := removeDiacritics("Ça va, très bien, tiếng Việt"); got != "Ca va, tres bien, tieng Viet" {
+		t.Errorf("removeDiacritics = %q", got)
+	}
+}
+
+func TestParseAnswers(t *testing.T) {
+	got := parseAnswers([]string{"auto; coche ;carro", " Coche", "", "vehículo"})
+	want := []string{"auto", "coche", "carro", "vehículo"}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseAnswers = %q, want %q", got, want)
+	}
+	if joined := joinAnswers(got); joined != "auto; coche; carro; vehículo" {
+		t.Errorf("joinAnswers = %q", joined)
+	}
+	if answers := (Card{Answer: "car"}).Answers(); !slices.Equal(answers, []string{"car"}) {
+		t.Errorf("Answers of a single answer = %q", answers)
+	}
+}
+
+func TestCheckAnswers(t *testing.T) {
+	checker := TypoChecker{Tolerance: 1}
+	answers := []string{"auto", "coche", "carro"}
+	tests := []struct {
+		userAnswer  string
+		wantVerdict Verdict
+		wantAnswer  string
+	}{
+		{"coche", VerdictCorrect, "coche"},
+		{"caro", VerdictNearMiss, "carro"},
+		{"bus", VerdictWrong, "auto"},
+	}
+	for _, test := range tests {
+		verdict, answer := checkAnswers(checker, test.userAnswer, answers)
+		if verdict != test.wantVerdict || answer != test.wantAnswer {
+			t.Errorf("checkAnswers(%q) = %d, %q, want %d, %q", test.userAnswer, verdict, answer, test.wantVerdict, test.wantAnswer)
+		}
+	}
+}
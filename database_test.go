@@ -0,0 +1,657 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB returns a GormDB on an empty in-memory database.
+func newTestDB(t *testing.T) *GormDB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection to :memory: opens a database of its own
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	err = db.AutoMigrate(&Deck{}, &Card{}, &Tag{}, &ReviewLog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &GormDB{db: db}
+}
+
+func createTestDeck(t *testing.T, g *GormDB, name string) Deck {
+	t.Helper()
+	err := g.createDeck(name, "doubling", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deck Deck
+	err = g.db.Where("name = ?", name).First(&deck).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return deck
+}
+
+// createTestCard creates a learning card that became due at due.
+func createTestCard(t *testing.T, g *GormDB, deck Deck, question string, answer string, due time.Time) Card {
+	t.Helper()
+	card := Card{DeckID: deck.ID, Question: question, Answer: answer, CardCreated: due, ReviewDueDate: due}
+	err := g.db.Create(&card).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return card
+}
+
+func cardQuestions(cards []Card) []string {
+	questions := make([]string, len(cards))
+	for i, card := range cards {
+		questions[i] = card.Question
+	}
+	slices.Sort(questions)
+	return questions
+}
+
+func TestSiblingNotStudiedToday(t *testing.T) {
+	g := newTestDB(t)
+	deck := createTestDeck(t, g, "Spanish")
+	now := time.Now().UTC()
+
+	err := g.createCardPair(Card{DeckID: deck.ID, Question: "perro", Answer: "dog", CardCreated: now.Add(-time.Hour), ReviewDueDate: now.Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var forward, reverse Card
+	g.db.Where("question = ?", "perro").First(&forward)
+	g.db.Where("question = ?", "dog").First(&reverse)
+	g.db.Model(&reverse).Update("review_due_date", now.Add(-2*time.Hour))
+	createTestCard(t, g, deck, "gato", "cat", now.Add(-time.Minute))
+
+	// the reverse card is due before the cat, until its sibling is studied
+	card, err := g.getMostDueLearningCardByDeckID(deck.ID, nil)
+	if err != nil || card.ID != reverse.ID {
+		t.Fatalf("most due card before studying = %q, %v", card.Question, err)
+	}
+	err = g.updateLearningCardByID(forward.ID, GradeGood)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	card, err = g.getMostDueLearningCardByDeckID(deck.ID, nil)
+	if err != nil || card.Question != "gato" {
+		t.Errorf("most due card after studying the sibling = %q, %v, want gato", card.Question, err)
+	}
+	learning, _ := g.getLearningCardsByDeckID(deck.ID)
+	if got := cardQuestions(learning); !slices.Equal(got, []string{"gato", "perro"}) {
+		t.Errorf("learning cards = %q, want gato and perro", got)
+	}
+
+	g.db.Model(&Card{}).Where("id IN ?", []uint{reverse.ID, forward.ID}).Updates(map[string]any{"stage": "review", "review_due_date": now.Add(-time.Hour)})
+	g.db.Model(&Card{}).Where("question = ?", "gato").Updates(map[string]any{"stage": "review", "review_due_date": now.Add(-time.Hour)})
+	due, _ := g.getDueReviewCardsByDeckID(deck.ID)
+	if got := cardQuestions(due); !slices.Equal(got, []string{"gato", "perro"}) {
+		t.Errorf("due review cards = %q, want gato and perro", got)
+	}
+
+	// the next day the sibling was studied yesterday
+	today := now.Truncate(24 * time.Hour)
+	g.db.Model(&Card{}).Where("id = ?", forward.ID).Update("last_review_date", today.Add(-time.Second))
+	due, _ = g.getDueReviewCardsByDeckID(deck.ID)
+	if got := cardQuestions(due); !slices.Equal(got, []string{"dog", "gato", "perro"}) {
+		t.Errorf("due review cards the next day = %q, want all three", got)
+	}
+	card, err = g.getMostDueReviewCardByDeckID(deck.ID, nil)
+	if err != nil || card.ID != forward.ID && card.ID != reverse.ID {
+		t.Errorf("most due card the next day = %q, %v, want one of the pair", card.Question, err)
+	}
+}
+
+func TestRandomCardsLeaveOutSibling(t *testing.T) {
+	g := newTestDB(t)
+	deck := createTestDeck(t, g, "Spanish")
+	now := time.Now().UTC()
+
+	err := g.createCardPair(Card{DeckID: deck.ID, Question: "perro", Answer: "dog", CardCreated: now, ReviewDueDate: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var forward Card
+	g.db.Where("question = ?", "perro").First(&forward)
+	createTestCard(t, g, deck, "gato", "cat", now)
+	createTestCard(t, g, deck, "casa", "house", now)
+
+	for range 10 {
+		cards, err := g.getRandomCardsByDeckID(deck.ID, forward.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cardQuestions(cards); !slices.Equal(got, []string{"casa", "gato"}) {
+			t.Fatalf("distractors = %q, want casa and gato", got)
+		}
+	}
+}
+
+func TestAcceptAnswer(t *testing.T) {
+	g := newTestDB(t)
+	deck := createTestDeck(t, g, "Spanish")
+	card := createTestCard(t, g, deck, "car", "auto", time.Now().UTC())
+
+	err := g.updateLearningCardByID(card.ID, GradeAgain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	card, err = g.acceptAnswer(card.ID, "coche")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if card.Answer != "auto; coche" || card.Correct != 1 || card.Incorrect != 0 {
+		t.Errorf("accepted card = %q, %d correct, %d incorrect", card.Answer, card.Correct, card.Incorrect)
+	}
+	var reviews []ReviewLog
+	g.db.Where("card_id = ?", card.ID).Find(&reviews)
+	if len(reviews) != 1 || reviews[0].Grade != GradeGood {
+		t.Errorf("reviews after accepting = %+v, want one good review", reviews)
+	}
+
+	// without a review to revert nothing changes
+	_, err = g.acceptAnswer(card.ID, "carro")
+	if err != errNoReviewToRevert {
+		t.Errorf("accepting a good answer: err = %v", err)
+	}
+
+	// a failing step undoes the ones before it
+	other := createTestCard(t, g, deck, "dog", "perro", time.Now().UTC())
+	err = g.updateLearningCardByID(other.ID, GradeAgain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.db.Exec("DELETE FROM decks WHERE id = ?", deck.ID)
+	_, err = g.acceptAnswer(other.ID, "can")
+	if err == nil {
+		t.Fatal("accepting an answer without a deck succeeded")
+	}
+	other, _ = g.getCardByID(other.ID)
+	g.db.Where("card_id = ?", other.ID).Find(&reviews)
+	if other.Answer != "perro" || len(reviews) != 1 || reviews[0].Grade != GradeAgain {
+		t.Errorf("failed accept left %q and reviews %+v", other.Answer, reviews)
+	}
+}
+
+func TestUpdateCardKeepsSiblingInStep(t *testing.T) {
+	g := newTestDB(t)
+	deck := createTestDeck(t, g, "Spanish")
+	now := time.Now().UTC()
+
+	err := g.createCardPair(Card{DeckID: deck.ID, Question: "coche", Answer: "car; auto", CardCreated: now, ReviewDueDate: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var forward, reverse Card
+	g.db.Where("question = ?", "coche").First(&forward)
+	g.db.Where("sibling_id = ?", forward.ID).First(&reverse)
+	if reverse.Question != "car" || reverse.Answer != "coche" {
+		t.Fatalf("reverse card = %q -> %q, want car -> coche", reverse.Question, reverse.Answer)
+	}
+
+	// a synonym added to the reverse card survives edits of the forward one
+	reverse.Answer = "coche; carro"
+	err = g.updateCard(reverse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.db.First(&forward, forward.ID)
+	if forward.Question != "coche" || forward.Answer != "car; auto" {
+		t.Errorf("forward card = %q -> %q, want coche -> car; auto", forward.Question, forward.Answer)
+	}
+
+	forward.Answer = "car; automobile"
+	err = g.updateCard(forward)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.db.First(&reverse, reverse.ID)
+	if reverse.Question != "car" || reverse.Answer != "coche; carro" {
+		t.Errorf("reverse card = %q -> %q, want car -> coche; carro", reverse.Question, reverse.Answer)
+	}
+
+	forward.Question = "el coche"
+	forward.Answer = "automobile"
+	err = g.updateCard(forward)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.db.First(&reverse, reverse.ID)
+	if reverse.Question != "automobile" || reverse.Answer != "el coche; carro" {
+		t.Errorf("reverse card = %q -> %q, want automobile -> el coche; carro", reverse.Question, reverse.Answer)
+	}
+}
+
+// studiedQuestions returns the questions of the learning and due review cards
+// of a deck, and checks that the deck tree counts the same cards.
+func studiedQuestions(t *testing.T, g *GormDB, deck Deck) []string {
+	t.Helper()
+	learning, err := g.getLearningCardsByDeckID(deck.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, err := g.getDueReviewCardsByDeckID(deck.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := g.getDeckTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range tree {
+		if node.Deck.ID == deck.ID && (node.New != int64(len(learning)) || node.Due != int64(len(due))) {
+			t.Errorf("deck tree counts %d new and %d due, want %d and %d", node.New, node.Due, len(learning), len(due))
+		}
+	}
+	return cardQuestions(append(learning, due...))
+}
+
+func TestSuspendAndBuryCards(t *testing.T) {
+	g := newTestDB(t)
+	deck := createTestDeck(t, g, "Spanish")
+	now := time.Now().UTC()
+
+	perro := createTestCard(t, g, deck, "perro", "dog", now.Add(-2*time.Hour))
+	gato := createTestCard(t, g, deck, "gato", "cat", now.Add(-time.Hour))
+	casa := createTestCard(t, g, deck, "casa", "house", now.Add(-2*time.Hour))
+	createTestCard(t, g, deck, "mesa", "table", now.Add(-time.Hour))
+	createTestCard(t, g, deck, "libro", "book", now)
+	createTestCard(t, g, deck, "silla", "chair", now)
+	g.db.Model(&Card{}).Where("question IN ?", []string{"casa", "mesa"}).Update("stage", "review")
+
+	err := g.suspendCardByID(perro.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.buryCardByID(casa.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.db.First(&casa, casa.ID)
+	if !casa.BuriedUntil.Equal(startOfNextDay(now)) {
+		t.Errorf("buried until %v, want the start of the next day", casa.BuriedUntil)
+	}
+
+	if got := studiedQuestions(t, g, deck); !slices.Equal(got, []string{"gato", "libro", "mesa", "silla"}) {
+		t.Errorf("studied cards = %q, want the cards that aren't suspended or buried", got)
+	}
+	card, err := g.getMostDueLearningCardByDeckID(deck.ID, nil)
+	if err != nil || card.Question != "gato" {
+		t.Errorf("most due learning card = %q, %v, want gato", card.Question, err)
+	}
+	card, err = g.getMostDueReviewCardByDeckID(deck.ID, nil)
+	if err != nil || card.Question != "mesa" {
+		t.Errorf("most due review card = %q, %v, want mesa", card.Question, err)
+	}
+	distractors, err := g.getRandomCardsByDeckID(deck.ID, gato.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cardQuestions(distractors); !slices.Equal(got, []string{"libro", "mesa", "silla"}) {
+		t.Errorf("distractors = %q, want the cards that aren't suspended or buried", got)
+	}
+
+	err = g.unsuspendCardByID(perro.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	card, err = g.getMostDueLearningCardByDeckID(deck.ID, nil)
+	if err != nil || card.Question != "perro" {
+		t.Errorf("most due learning card after unsuspending = %q, %v, want perro", card.Question, err)
+	}
+
+	// the next day the buried card is back
+	g.db.Model(&casa).Update("buried_until", now.Add(-time.Second))
+	card, err = g.getMostDueReviewCardByDeckID(deck.ID, nil)
+	if err != nil || card.Question != "casa" {
+		t.Errorf("most due review card the next day = %q, %v, want casa", card.Question, err)
+	}
+	if got := studiedQuestions(t, g, deck); len(got) != 6 {
+		t.Errorf("studied cards the next day = %q, want all six", got)
+	}
+}
+
+func TestDeleteRestoreAndPurgeCards(t *testing.T) {
+	g := newTestDB(t)
+	deck := createTestDeck(t, g, "Spanish")
+	now := time.Now().UTC()
+
+	perro := Card{DeckID: deck.ID, Question: "perro", Answer: "dog", CardCreated: now, ReviewDueDate: now, Tags: []Tag{{Name: "animals"}}}
+	err := g.db.Create(&perro).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	gato := createTestCard(t, g, deck, "gato", "cat", now)
+
+	err = g.deleteCardByID(perro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := studiedQuestions(t, g, deck); !slices.Equal(got, []string{"gato"}) {
+		t.Errorf("studied cards after deleting = %q, want gato", got)
+	}
+	cards, _ := g.getAllCardsByDeckID(deck.ID)
+	if got := cardQuestions(cards); !slices.Equal(got, []string{"gato"}) {
+		t.Errorf("cards of the deck after deleting = %q, want gato", got)
+	}
+
+	restored, err := g.restoreCardByID(perro.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.Tags) != 1 || restored.Tags[0].Name != "animals" {
+		t.Errorf("restored card has tags %+v, want animals", restored.Tags)
+	}
+	if got := studiedQuestions(t, g, deck); !slices.Equal(got, []string{"gato", "perro"}) {
+		t.Errorf("studied cards after restoring = %q, want gato and perro", got)
+	}
+
+	// perro was deleted before the retention ran out, gato just now
+	for _, card := range []Card{perro, gato} {
+		err = g.updateLearningCardByID(card.ID, GradeGood)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.deleteCardByID(card)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.db.Unscoped().Model(&perro).Update("deleted_at", now.Add(-deletedCardRetention-time.Hour))
+
+	purged, err := g.purgeDeletedCards(now.Add(-deletedCardRetention))
+	if err != nil || purged != 1 {
+		t.Fatalf("purged %d cards, %v, want 1", purged, err)
+	}
+	var count int64
+	g.db.Unscoped().Model(&Card{}).Where("id = ?", perro.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("purged card is still there")
+	}
+	g.db.Model(&ReviewLog{}).Where("card_id = ?", perro.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("purged card left %d reviews", count)
+	}
+	g.db.Table("card_tags").Where("card_id = ?", perro.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("purged card left %d tags", count)
+	}
+	g.db.Model(&ReviewLog{}).Where("card_id = ?", gato.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("card deleted within the retention has %d reviews, want 1", count)
+	}
+	if _, err := g.restoreCardByID(gato.ID); err != nil {
+		t.Errorf("card deleted within the retention can't be restored: %v", err)
+	}
+}
+
+func TestPurgeUnlinksDeletedSibling(t *testing.T) {
+	g := newTestDB(t)
+	deck := createTestDeck(t, g, "Spanish")
+	now := time.Now().UTC()
+
+	err := g.createCardPair(Card{DeckID: deck.ID, Question: "perro", Answer: "dog", CardCreated: now, ReviewDueDate: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var forward, reverse Card
+	g.db.Where("question = ?", "perro").First(&forward)
+	g.db.Where("question = ?", "dog").First(&reverse)
+	g.deleteCardByID(forward)
+	g.deleteCardByID(reverse)
+	g.db.Unscoped().Model(&forward).Update("deleted_at", now.Add(-deletedCardRetention-time.Hour))
+
+	_, err = g.purgeDeletedCards(now.Add(-deletedCardRetention))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reverse, err = g.restoreCardByID(reverse.ID)
+	if err != nil || reverse.SiblingID != 0 {
+		t.Errorf("restored sibling of a purged card links to %d, %v, want 0", reverse.SiblingID, err)
+	}
+}
+
+func TestSearchCardsWithoutIndexMatchesWildcardsLiterally(t *testing.T) {
+	g := newTestDB(t)
+	deck := createTestDeck(t, g, "Spanish")
+	now := time.Now().UTC()
+	createTestCard(t, g, deck, "100%", "cien por cien", now)
+	createTestCard(t, g, deck, "1000", "mil", now)
+	createTestCard(t, g, deck, "snake_case", "", now)
+	createTestCard(t, g, deck, "snakeXcase", "", now)
+
+	for term, want := range map[string][]string{"0%": {"100%"}, "e_c": {"snake_case"}, "%": {"100%"}, "mil": {"1000"}} {
+		cards, err := g.searchCards(SearchQuery{Terms: []string{term}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cardQuestions(cards); !slices.Equal(got, want) {
+			t.Errorf("search for %q = %q, want %q", term, got, want)
+		}
+	}
+}
+
+func TestLeechesAreTagged(t *testing.T) {
+	g := newTestDB(t)
+	deck := createTestDeck(t, g, "Spanish")
+	g.db.Model(&deck).Update("leech_threshold", 1)
+	card := createTestCard(t, g, deck, "perro", "dog", time.Now().UTC())
+	other := createTestCard(t, g, deck, "gato", "cat", time.Now().UTC())
+	g.db.Model(&Card{}).Where("id IN ?", []uint{card.ID, other.ID}).Updates(map[string]any{"stage": "review", "interval": 4 * 24 * time.Hour})
+
+	for range 2 {
+		err := g.updateReviewCardByID(card.ID, GradeAgain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.db.Model(&card).Update("stage", "review")
+	}
+	err := g.updateReviewCardByID(other.ID, GradeGood)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	card, _ = g.getCardByID(card.ID)
+	if !card.Leech || len(card.Tags) != 1 || card.Tags[0].Name != leechTag {
+		t.Errorf("leech %v with tags %+v, want one leech tag", card.Leech, card.Tags)
+	}
+	cards, err := g.searchCards(SearchQuery{Tags: []string{leechTag}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cardQuestions(cards); !slices.Equal(got, []string{"perro"}) {
+		t.Errorf("cards tagged as leech = %q, want perro", got)
+	}
+}
+
+func TestMergeDeckIntoItself(t *testing.T) {
+	g := newTestDB(t)
+	deck := createTestDeck(t, g, "Spanish")
+	createTestCard(t, g, deck, "perro", "dog", time.Now().UTC())
+
+	err := g.mergeDecks(deck.ID, deck.ID, "keep-target")
+	if err == nil || err.Error() != "a deck can't be merged into itself" {
+		t.Errorf("merging a deck into itself: err = %v", err)
+	}
+	cards, _ := g.getAllCardsByDeckID(deck.ID)
+	if len(cards) != 1 {
+		t.Errorf("deck has %d cards after merging into itself, want 1", len(cards))
+	}
+}
+
+func TestLeechTagFollowsLeechFlag(t *testing.T) {
+	g := newTestDB(t)
+	deck := createTestDeck(t, g, "Spanish")
+	g.db.Model(&deck).Update("leech_threshold", 1)
+	card := createTestCard(t, g, deck, "perro", "dog", time.Now().UTC())
+
+	lapse := func() {
+		t.Helper()
+		g.db.Model(&card).Updates(map[string]any{"stage": "review", "interval": 4 * 24 * time.Hour, "ease": 4})
+		err := g.updateReviewCardByID(card.ID, GradeAgain)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tagged := func() bool {
+		t.Helper()
+		cards, err := g.searchCards(SearchQuery{Tags: []string{leechTag}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(cards) > 0
+	}
+
+	lapse()
+	if !tagged() {
+		t.Fatal("leech is not tagged")
+	}
+	_, err := g.acceptAnswer(card.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if card, _ = g.getCardByID(card.ID); card.Leech || tagged() {
+		t.Errorf("accepted answer left leech %v, tagged %v", card.Leech, tagged())
+	}
+
+	lapse()
+	err = g.bulkUpdateCards([]uint{card.ID}, BulkAction{Name: "reset"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tagged() {
+		t.Errorf("reset card is still tagged as leech")
+	}
+
+	lapse()
+	card, _ = g.getCardByID(card.ID)
+	err = g.updateCard(resetScheduling(card, time.Now().UTC()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tagged() {
+		t.Errorf("card reset in the editor is still tagged as leech")
+	}
+}
+
+func TestAcceptAnswerLeavesNoLeechTrace(t *testing.T) {
+	g := newTestDB(t)
+	deck := createTestDeck(t, g, "Spanish")
+	g.db.Model(&deck).Updates(map[string]any{"leech_threshold": 1, "leech_action": "suspend"})
+	card := createTestCard(t, g, deck, "perro", "dog", time.Now().UTC())
+	g.db.Model(&card).Updates(map[string]any{"stage": "review", "interval": 4 * 24 * time.Hour, "ease": 4})
+
+	err := g.updateReviewCardByID(card.ID, GradeAgain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	card, _ = g.getCardByID(card.ID)
+	if !card.Leech || !card.Suspended || len(card.Tags) != 1 {
+		t.Fatalf("lapsed card has leech %v, suspended %v, tags %+v", card.Leech, card.Suspended, card.Tags)
+	}
+
+	card, err = g.acceptAnswer(card.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if card.Leech || card.Suspended || card.Lapses != 0 || len(card.Tags) != 0 {
+		t.Errorf("accepted card has leech %v, suspended %v, %d lapses, tags %+v", card.Leech, card.Suspended, card.Lapses, card.Tags)
+	}
+	leeches, _ := g.getLeechCards()
+	if len(leeches) != 0 {
+		t.Errorf("accepted card is still listed as a leech")
+	}
+}
+
+func TestEasyLearningAnswerGetsEasyInterval(t *testing.T) {
+	g := newTestDB(t)
+	deck := createTestDeck(t, g, "Spanish")
+	g.db.Model(&deck).Updates(map[string]any{"easy_interval": 6, "fuzz_percent": 0})
+	card := createTestCard(t, g, deck, "perro", "dog", time.Now().UTC())
+
+	err := g.updateLearningCardByID(card.ID, GradeEasy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	card, _ = g.getCardByID(card.ID)
+	if card.Stage != "review" || card.Interval != 6*24*time.Hour {
+		t.Errorf("got stage %q interval %v want review 144h", card.Stage, card.Interval)
+	}
+}
+
+func TestBulkUpdateCardsCarriesOverToSiblings(t *testing.T) {
+	g := newTestDB(t)
+	deck := createTestDeck(t, g, "Spanish")
+	other := createTestDeck(t, g, "Animals")
+	now := time.Now().UTC()
+
+	err := g.createCardPair(Card{DeckID: deck.ID, Question: "perro", Answer: "dog", CardCreated: now, ReviewDueDate: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var forward, reverse Card
+	g.db.Where("question = ?", "perro").First(&forward)
+	g.db.Where("question = ?", "dog").First(&reverse)
+	gato := createTestCard(t, g, deck, "gato", "cat", now)
+
+	for _, action := range []BulkAction{{Name: "move", DeckID: other.ID}, {Name: "add-tag", Tag: "pets"}, {Name: "suspend"}} {
+		err = g.bulkUpdateCards([]uint{forward.ID, gato.ID}, action)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	reverse, _ = g.getCardByID(reverse.ID)
+	if reverse.DeckID != other.ID || len(reverse.Tags) != 1 || reverse.Tags[0].Name != "pets" {
+		t.Errorf("sibling is in deck %d with tags %+v, want deck %d tagged pets", reverse.DeckID, reverse.Tags, other.ID)
+	}
+	// scheduling is up to each card
+	if reverse.Suspended {
+		t.Errorf("suspending a card suspended its sibling")
+	}
+
+	err = g.bulkUpdateCards([]uint{reverse.ID}, BulkAction{Name: "remove-tag", Tag: "pets"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forward, _ = g.getCardByID(forward.ID)
+	if len(forward.Tags) != 0 {
+		t.Errorf("sibling still has tags %+v", forward.Tags)
+	}
+}
+
+func TestFilterCardsByDecks(t *testing.T) {
+	g := newTestDB(t)
+	deck := createTestDeck(t, g, "Spanish")
+	other := createTestDeck(t, g, "French")
+	now := time.Now().UTC()
+	perro := createTestCard(t, g, deck, "perro", "dog", now)
+	gato := createTestCard(t, g, deck, "gato", "cat", now)
+	chien := createTestCard(t, g, other, "chien", "dog", now)
+	g.deleteCardByID(gato)
+
+	ids, err := g.filterCardsByDecks([]uint{perro.ID, gato.ID, chien.ID, 999}, []uint{deck.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ids, []uint{perro.ID, gato.ID}) {
+		t.Errorf("filtered IDs = %v, want %d and the deleted %d", ids, perro.ID, gato.ID)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DiffPart is a run of characters in the diff of a typed answer against the
+// correct one. Kind is "same" for characters that were typed right, "wrong"
+// for characters typed instead of the expected ones, "extra" for characters
+// that don't belong in the answer and "missing" for characters that weren't
+// typed.
+type DiffPart struct {
+	Kind     string
+	Typed    string
+	Expected string
+}
+
+// diffAnswer lines up a typed answer with the correct one in the fewest
+// edits and returns the differences character by character. Case and
+// surrounding space are ignored like they are when answers are checked.
+func diffAnswer(userAnswer string, answer string) []DiffPart {
+	typed := []rune(strings.TrimSpace(userAnswer))
+	expected := []rune(strings.TrimSpace(answer))
+
+	// distances[i][j] is the edit distance of typed[i:] and expected[j:]
+	distances := make([][]int, len(typed)+1)
+	for i := range distances {
+		distances[i] = make([]int, len(expected)+1)
+		distances[i][len(expected)] = len(typed) - i
+	}
+	for j := range expected {
+		distances[len(typed)][j] = len(expected) - j
+	}
+	for i := len(typed) - 1; i >= 0; i-- {
+		for j := len(expected) - 1; j >= 0; j-- {
+			cost := 1
+			if sameLetter(typed[i], expected[j]) {
+				cost = 0
+			}
+			distances[i][j] = min(distances[i+1][j+1]+cost, distances[i+1][j]+1, distances[i][j+1]+1)
+		}
+	}
+
+	var parts []DiffPart
+	add := func(kind string, typed string, expected string) {
+		last := len(parts) - 1
+		if last >= 0 && parts[last].Kind == kind {
+			parts[last].Typed += typed
+			parts[last].Expected += expected
+			return
+		}
+		parts = append(parts, DiffPart{Kind: kind, Typed: typed, Expected: expected})
+	}
+
+	i, j := 0, 0
+	for i < len(typed) || j < len(expected) {
+		switch {
+		case i < len(typed) && j < len(expected) && sameLetter(typed[i], expected[j]) && distances[i][j] == distances[i+1][j+1]:
+			add("same", string(typed[i]), string(expected[j]))
+			i, j = i+1, j+1
+		case i < len(typed) && j < len(expected) && distances[i][j] == distances[i+1][j+1]+1:
+			add("wrong", string(typed[i]), string(expected[j]))
+			i, j = i+1, j+1
+		case i < len(typed) && distances[i][j] == distances[i+1][j]+1:
+			add("extra", string(typed[i]), "")
+			i++
+		default:
+			add("missing", "", string(expected[j]))
+			j++
+		}
+	}
+	return parts
+}
+
+func sameLetter(a rune, b rune) bool {
+	return unicode.ToLower(a) == unicode.ToLower(b)
+}
+
+// closestAnswer returns the accepted answer that is the fewest edits away
+// from the typed one.
+func closestAnswer(userAnswer string, answers []string) string {
+	closest, distance := "", -1
+	for _, answer := range answers {
+		d := editDistance(strings.ToLower(strings.TrimSpace(userAnswer)), strings.ToLower(answer))
+		if distance < 0 || d < distance {
+			closest, distance = answer, d
+		}
+	}
+	return closest
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffAnswer(t *testing.T) {
+	tests := []struct {
+		userAnswer, answer string
+		want               []DiffPart
+	}{
+		{"Receive", "receive", []DiffPart{{"same", "Receive", "receive"}}},
+		{"recive", "receive", []DiffPart{{"same", "rec", "rec"}, {"missing", "", "e"}, {"same", "ive", "ive"}}},
+		{"receeve", "receive", []DiffPart{{"same", "rece", "rece"}, {"wrong", "e", "i"}, {"same", "ve", "ve"}}},
+		{"receives", "receive", []DiffPart{{"same", "receive", "receive"}, {"extra", "s", ""}}},
+		{"", "dog", []DiffPart{{"missing", "", "dog"}}},
+		{"cat", "dog", []DiffPart{{"wrong", "cat", "dog"}}},
+	}
+	for _, test := range tests {
+		if got := diffAnswer(test.userAnswer, test.answer); !slices.Equal(got, test.want) {
+			t.Errorf("diffAnswer(%q, %q) = %+v, want %+v", test.userAnswer, test.answer, got, test.want)
+		}
+	}
+}
+
+func TestClosestAnswer(t *testing.T) {
+	if got := closestAnswer("coch", []string{"auto", "coche", "carro"}); got != "coche" {
+		t.Errorf("closestAnswer = %q, want coche", got)
+	}
+}
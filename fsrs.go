@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FSRS weights as published with FSRS v4.5. They are used for every deck
+// until the optimizer has fitted weights to the deck's own review history.
+var defaultFSRSWeights = [17]float64{
+	0.4872, 1.4003, 3.7145, 13.8206, 5.1618, 1.2298, 0.8975, 0.031,
+	1.6474, 0.1367, 1.0461, 2.1072, 0.0793, 0.3246, 1.587, 0.2272, 2.8755,
+}
+
+// Bounds the optimizer keeps each weight in.
+var (
+	fsrsLowerBounds = [17]float64{0.1, 0.1, 0.1, 0.1, 1, 0.1, 0.1, 0, 0, 0.1, 0.01, 0.5, 0.01, 0.01, 0.01, 0, 1}
+	fsrsUpperBounds = [17]float64{100, 100, 100, 100, 10, 5, 5, 0.5, 3, 0.8, 2.5, 5, 0.2, 0.9, 2, 1, 6}
+)
+
+const (
+	fsrsDecay            = -0.5
+	fsrsFactor           = 19.0 / 81.0
+	fsrsDesiredRetention = 0.9
+	fsrsMaximumInterval  = 36500
+)
+
+// FSRSScheduler implements the Free Spaced Repetition Scheduler. Instead of an
+// ease it keeps the memory stability (days until recall drops to 90%) and the
+// difficulty (1 to 10) of each card and picks the interval at which the
+// probability of recalling the card falls to the desired retention.
+type FSRSScheduler struct {
+	Steps   LearningSteps
+	Weights [17]float64
+}
+
+func newFSRSScheduler(deck Deck) Scheduler {
+	weights, err := parseFSRSWeights(deck.FSRSWeights)
+	if err != nil {
+		weights = defaultFSRSWeights
+	}
+	return FSRSScheduler{Steps: learningStepsFor(deck), Weights: weights}
+}
+
+func (s FSRSScheduler) Schedule(card Card, grade Grade, now time.Time) Card {
+	if card.Stability == 0 {
+		card.Stability = s.initialStability(grade)
+		card.Difficulty = s.initialDifficulty(grade)
+	} else {
+		elapsed := card.Interval.Hours() / 24
+		if !card.LastReviewDate.IsZero() {
+			elapsed = now.Sub(card.LastReviewDate).Hours() / 24
+		}
+		card.Stability, card.Difficulty = s.nextState(card.Stability, card.Difficulty, math.Max(elapsed, 0), grade)
+	}
+
+	// FSRS derives every interval from the stability, so neither the
+	// graduating interval nor the lapse percentage of the deck is used
+	interval := time.Duration(fsrsInterval(card.Stability)) * 24 * time.Hour
+	var delay time.Duration
+
+	switch {
+	case card.Stage == "learning":
+		var graduated bool
+		card, graduated = s.Steps.learn(card, grade)
+		if graduated {
+			card.Stage = "review"
+			card.Interval = interval
+		}
+		delay = card.Interval
+	case card.Stage == "relearning":
+		card.Interval = interval
+		card, delay, _ = s.Steps.relearn(card, grade)
+	case grade == GradeAgain:
+		card.Lapses++
+		card, delay = s.Steps.lapse(card, interval)
+	default:
+		card.Interval = interval
+		delay = interval
+	}
+
+	card.ReviewDueDate = now.Add(delay)
+	return card
+}
+
+func (s FSRSScheduler) initialStability(grade Grade) float64 {
+	return math.Max(s.Weights[grade], 0.1)
+}
+
+func (s FSRSScheduler) initialDifficulty(grade Grade) float64 {
+	rating := float64(grade) + 1
+	return clampDifficulty(s.Weights[4] - (rating-3)*s.Weights[5])
+}
+
+// nextState returns the stability and difficulty of a card that was
+// answered with grade after elapsed days.
+func (s FSRSScheduler) nextState(stability float64, difficulty float64, elapsed float64, grade Grade) (float64, float64) {
+	w := s.Weights
+	rating := float64(grade) + 1
+	retrievability := fsrsRetrievability(elapsed, stability)
+
+	var nextStability float64
+	if grade == GradeAgain {
+		nextStability = w[11] * math.Pow(difficulty, -w[12]) * (math.Pow(stability+1, w[13]) - 1) * math.Exp(w[14]*(1-retrievability))
+		nextStability = math.Min(nextStability, stability)
+	} else {
+		growth := math.Exp(w[8]) * (11 - difficulty) * math.Pow(stability, -w[9]) * (math.Exp(w[10]*(1-retrievability)) - 1)
+		if grade == GradeHard {
+			growth *= w[15]
+		}
+		if grade == GradeEasy {
+			growth *= w[16]
+		}
+		nextStability = stability * (1 + growth)
+	}
+
+	nextDifficulty := difficulty - w[6]*(rating-3)
+	nextDifficulty = w[7]*s.initialDifficulty(GradeGood) + (1-w[7])*nextDifficulty
+
+	return math.Max(nextStability, 0.1), clampDifficulty(nextDifficulty)
+}
+
+func clampDifficulty(difficulty float64) float64 {
+	return math.Min(math.Max(difficulty, 1), 10)
+}
+
+// fsrsRetrievability is the probability of recalling a card with the given
+// stability after elapsed days.
+func fsrsRetrievability(elapsed float64, stability float64) float64 {
+	return math.Pow(1+fsrsFactor*elapsed/stability, fsrsDecay)
+}
+
+// fsrsInterval is the number of days until the retrievability of a card
+// with the given stability drops to the desired retention.
+func fsrsInterval(stability float64) int {
+	days := stability / fsrsFactor * (math.Pow(fsrsDesiredRetention, 1/fsrsDecay) - 1)
+	return int(math.Min(math.Max(math.Round(days), 1), fsrsMaximumInterval))
+}
+
+func parseFSRSWeights(value string) ([17]float64, error) {
+	var weights [17]float64
+	fields := strings.Split(value, ",")
+	if len(fields) != len(weights) {
+		return weights, fmt.Errorf("expected %d FSRS weights, got %d", len(weights), len(fields))
+	}
+	for i, field := range fields {
+		weight, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return weights, err
+		}
+		weights[i] = weight
+	}
+	return weights, nil
+}
+
+func formatFSRSWeights(weights [17]float64) string {
+	fields := make([]string, len(weights))
+	for i, weight := range weights {
+		fields[i] = strconv.FormatFloat(weight, 'f', 4, 64)
+	}
+	return strings.Join(fields, ",")
+}
+
+// fsrsLoss replays the review histories of a deck with the given weights and
+// returns the mean log loss of the predicted recall probability for every
+// review that happened at least a day after the previous one. The second
+// return value is the number of reviews that were scored.
+func fsrsLoss(weights [17]float64, histories [][]ReviewLog) (float64, int) {
+	scheduler := FSRSScheduler{Weights: weights}
+	var loss float64
+	var scored int
+
+	for _, history := range histories {
+		var stability, difficulty float64
+		for i, review := range history {
+			if i == 0 {
+				stability = scheduler.initialStability(review.Grade)
+				difficulty = scheduler.initialDifficulty(review.Grade)
+				continue
+			}
+
+			elapsed := review.Reviewed.Sub(history[i-1].Reviewed).Hours() / 24
+			if elapsed >= 1 {
+				retrievability := math.Min(math.Max(fsrsRetrievability(elapsed, stability), 1e-6), 1-1e-6)
+				if review.Grade == GradeAgain {
+					loss -= math.Log(1 - retrievability)
+				} else {
+					loss -= math.Log(retrievability)
+				}
+				scored++
+			}
+			stability, difficulty = scheduler.nextState(stability, difficulty, math.Max(elapsed, 0), review.Grade)
+		}
+	}
+
+	if scored == 0 {
+		return 0, 0
+	}
+	return loss / float64(scored), scored
+}
+
+// optimizeFSRSWeights fits FSRS weights to review histories, each of which
+// holds the reviews of one card in chronological order. It runs Adam on
+// numerical gradients of fsrsLoss, starting from the given weights and
+// keeping every weight within its bounds.
+func optimizeFSRSWeights(weights [17]float64, histories [][]ReviewLog, iterations int) [17]float64 {
+	const (
+		beta1   = 0.9
+		beta2   = 0.999
+		epsilon = 1e-8
+	)
+	var firstMoment, secondMoment [17]float64
+
+	for iteration := 1; iteration <= iterations; iteration++ {
+		var gradient [17]float64
+		for i := range weights {
+			step := (fsrsUpperBounds[i] - fsrsLowerBounds[i]) * 1e-5
+			up, down := weights, weights
+			up[i] += step
+			down[i] -= step
+			lossUp, _ := fsrsLoss(up, histories)
+			lossDown, _ := fsrsLoss(down, histories)
+			gradient[i] = (lossUp - lossDown) / (2 * step)
+		}
+
+		for i := range weights {
+			firstMoment[i] = beta1*firstMoment[i] + (1-beta1)*gradient[i]
+			secondMoment[i] = beta2*secondMoment[i] + (1-beta2)*gradient[i]*gradient[i]
+			corrected := firstMoment[i] / (1 - math.Pow(beta1, float64(iteration)))
+			scale := secondMoment[i] / (1 - math.Pow(beta2, float64(iteration)))
+
+			learningRate := (fsrsUpperBounds[i] - fsrsLowerBounds[i]) * 0.002
+			weights[i] -= learningRate * corrected / (math.Sqrt(scale) + epsilon)
+			weights[i] = math.Min(math.Max(weights[i], fsrsLowerBounds[i]), fsrsUpperBounds[i])
+		}
+	}
+	return weights
+}
+
+// groupReviewsByCard splits chronologically ordered reviews into one history per card.
+func groupReviewsByCard(reviews []ReviewLog) [][]ReviewLog {
+	index := map[uint]int{}
+	var histories [][]ReviewLog
+	for _, review := range reviews {
+		i, ok := index[review.CardID]
+		if !ok {
+			i = len(histories)
+			index[review.CardID] = i
+			histories = append(histories, nil)
+		}
+		histories[i] = append(histories[i], review)
+	}
+	return histories
+}
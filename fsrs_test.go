@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestFSRSSchedulerFirstReview(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	scheduler := FSRSScheduler{Weights: defaultFSRSWeights}
+
+	card := scheduler.Schedule(Card{Stage: "learning"}, GradeGood, now)
+
+	if card.Stage != "review" || card.Interval != 4*24*time.Hour {
+		t.Errorf("got stage %q interval %v want review 96h", card.Stage, card.Interval)
+	}
+	if card.Difficulty != defaultFSRSWeights[4] {
+		t.Errorf("got difficulty %v want %v", card.Difficulty, defaultFSRSWeights[4])
+	}
+}
+
+func TestOptimizeFSRSWeightsReducesLoss(t *testing.T) {
+	// simulate learners whose memory is four times as stable as the defaults assume
+	actual := defaultFSRSWeights
+	for i := 0; i < 4; i++ {
+		actual[i] *= 4
+	}
+	simulator := FSRSScheduler{Weights: actual}
+	random := rand.New(rand.NewSource(1))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var histories [][]ReviewLog
+	for card := uint(1); card <= 50; card++ {
+		reviewed := start
+		history := []ReviewLog{{CardID: card, Grade: GradeGood, Reviewed: reviewed}}
+		stability := simulator.initialStability(GradeGood)
+		difficulty := simulator.initialDifficulty(GradeGood)
+		for i := 0; i < 5; i++ {
+			elapsed := float64(random.Intn(10) + 1)
+			reviewed = reviewed.Add(time.Duration(elapsed) * 24 * time.Hour)
+			grade := GradeGood
+			if random.Float64() > fsrsRetrievability(elapsed, stability) {
+				grade = GradeAgain
+			}
+			history = append(history, ReviewLog{CardID: card, Grade: grade, Reviewed: reviewed})
+			stability, difficulty = simulator.nextState(stability, difficulty, elapsed, grade)
+		}
+		histories = append(histories, history)
+	}
+
+	before, scored := fsrsLoss(defaultFSRSWeights, histories)
+	after, _ := fsrsLoss(optimizeFSRSWeights(defaultFSRSWeights, histories, 50), histories)
+
+	if scored != 250 {
+		t.Fatalf("got %d scored reviews want 250", scored)
+	}
+	if after >= before {
+		t.Errorf("loss did not improve: before %.4f after %.4f", before, after)
+	}
+}
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
 	"log"
 	"math"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"golang.org/x/exp/rand"
 	"gorm.io/driver/sqlite"
@@ -16,71 +21,681 @@ import (
 )
 
 type Deck struct {
-	ID    uint `gorm:"primaryKey"`
-	Name  string
-	Cards []Card `gorm:"foreignKey:DeckID"`
+	ID                   uint `gorm:"primaryKey"`
+	Name                 string
+	ParentID             uint   `gorm:"default:0;index"`
+	Scheduler            string `gorm:"default:'doubling'"`
+	FSRSWeights          string `gorm:"default:''"`
+	LeitnerBoxes         uint   `gorm:"default:5"`
+	LearningSteps        string `gorm:"default:'1m'"`
+	RelearningSteps      string `gorm:"default:'1m'"`
+	GraduatingInterval   uint   `gorm:"default:1"`
+	EasyInterval         uint   `gorm:"default:4"`
+	LapseIntervalPercent uint   `gorm:"default:0"`
+	LeechThreshold       uint   `gorm:"default:8"`
+	LeechAction          string `gorm:"default:'tag'"`
+	FuzzPercent          uint   `gorm:"default:5"`
+	LoadBalance          bool   `gorm:"default:false"`
+	CreateReverse        bool   `gorm:"default:false"`
+	TypoTolerance        uint   `gorm:"default:1"`
+	NearMissPolicy       string `gorm:"default:'retry'"`
+	DiacriticMode        string `gorm:"default:'require'"`
+	Cards                []Card `gorm:"foreignKey:DeckID"`
 }
 
 type Card struct {
 	ID             uint `gorm:"primaryKey"`
 	DeckID         uint
-	Correct        uint   `gorm:"default:0"`
-	Incorrect      uint   `gorm:"default:0"`
-	CardCreated    string `gorm:"default:''"`
-	LastReviewDate string `gorm:"default:''"`
-	Stage          string `gorm:"default:'learning'"`
-	Lapses         uint   `gorm:"default:0"`
-	Ease           uint   `gorm:"default:1"`
-	ReviewDueDate  string `gorm:"default:''"`
+	Correct        uint `gorm:"default:0"`
+	Incorrect      uint `gorm:"default:0"`
+	CardCreated    time.Time
+	LastReviewDate time.Time
+	Stage          string        `gorm:"default:'learning'"`
+	Lapses         uint          `gorm:"default:0"`
+	Ease           uint          `gorm:"default:1"`
+	EaseFactor     float64       `gorm:"default:2.5"`
+	Repetitions    uint          `gorm:"default:0"`
+	Interval       time.Duration `gorm:"default:0"`
+	Stability      float64       `gorm:"default:0"`
+	Difficulty     float64       `gorm:"default:0"`
+	Box            uint          `gorm:"default:0"`
+	Step           uint          `gorm:"default:0"`
+	Leech          bool          `gorm:"default:false"`
+	Suspended      bool          `gorm:"default:false"`
+	BuriedUntil    time.Time
+	ReviewDueDate  time.Time `gorm:"index"`
 	Question       string
 	Answer         string
+	Notes          string
+	Tags           []Tag          `gorm:"many2many:card_tags;"`
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+	// SiblingID is the card that asks the other way around, from the answer
+	// to the question. Both are scheduled on their own.
+	SiblingID uint `gorm:"default:0;index"`
+}
+
+// Tag groups cards within and across decks.
+type Tag struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"uniqueIndex"`
+}
+
+// TagList returns the names of the card's tags separated by spaces, the way
+// they are entered.
+func (c Card) TagList() string {
+	names := make([]string, len(c.Tags))
+	for i, tag := range c.Tags {
+		names[i] = tag.Name
+	}
+	return strings.Join(names, " ")
+}
+
+// parseTags splits tags entered as a list separated by spaces or commas. Tags
+// are lower case and each one is returned once.
+func parseTags(value string) []string {
+	var tags []string
+	fields := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	for _, field := range fields {
+		if !slices.Contains(tags, field) {
+			tags = append(tags, field)
+		}
+	}
+	return tags
+}
+
+// TagChip is a tag filter on the deck page. Query selects the tag if it is
+// not selected and deselects it otherwise, keeping the other selected tags.
+type TagChip struct {
+	Name     string
+	Selected bool
+	Query    string
+}
+
+func tagChips(tags []Tag, selected []string) []TagChip {
+	chips := make([]TagChip, len(tags))
+	for i, tag := range tags {
+		chips[i] = TagChip{Name: tag.Name, Selected: slices.Contains(selected, tag.Name)}
+		if chips[i].Selected {
+			chips[i].Query = tagQuery(slices.DeleteFunc(slices.Clone(selected), func(name string) bool {
+				return name == tag.Name
+			}))
+		} else {
+			chips[i].Query = tagQuery(append(slices.Clone(selected), tag.Name))
+		}
+	}
+	return chips
+}
+
+// tagQuery is the query string that restricts a deck page or study session to tags.
+func tagQuery(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return "?" + url.Values{"tag": tags}.Encode()
+}
+
+// ReviewLog records a single answer to a card. The FSRS optimizer fits its
+// weights to these.
+type ReviewLog struct {
+	ID       uint `gorm:"primaryKey"`
+	CardID   uint `gorm:"index"`
+	DeckID   uint `gorm:"index"`
+	Grade    Grade
+	Stage    string
+	Reviewed time.Time
+	// Before is the scheduling state of the card before the review, so the
+	// review can be reverted. It is empty for reviews logged before it was added.
+	Before SchedulingState `gorm:"embedded;embeddedPrefix:before_"`
+}
+
+// SchedulingState holds the fields of a card that a review changes.
+type SchedulingState struct {
+	Stage          string
+	Lapses         uint
+	Ease           uint
+	EaseFactor     float64
+	Repetitions    uint
+	Interval       time.Duration
+	Stability      float64
+	Difficulty     float64
+	Box            uint
+	Step           uint
+	Leech          bool
+	Suspended      bool
+	Correct        uint
+	Incorrect      uint
+	LastReviewDate time.Time
+	ReviewDueDate  time.Time
+}
+
+func schedulingStateOf(card Card) SchedulingState {
+	return SchedulingState{
+		Stage:          card.Stage,
+		Lapses:         card.Lapses,
+		Ease:           card.Ease,
+		EaseFactor:     card.EaseFactor,
+		Repetitions:    card.Repetitions,
+		Interval:       card.Interval,
+		Stability:      card.Stability,
+		Difficulty:     card.Difficulty,
+		Box:            card.Box,
+		Step:           card.Step,
+		Leech:          card.Leech,
+		Suspended:      card.Suspended,
+		Correct:        card.Correct,
+		Incorrect:      card.Incorrect,
+		LastReviewDate: card.LastReviewDate,
+		ReviewDueDate:  card.ReviewDueDate,
+	}
+}
+
+// restore returns the card with the scheduling state s.
+func (s SchedulingState) restore(card Card) Card {
+	card.Stage = s.Stage
+	card.Lapses = s.Lapses
+	card.Ease = s.Ease
+	card.EaseFactor = s.EaseFactor
+	card.Repetitions = s.Repetitions
+	card.Interval = s.Interval
+	card.Stability = s.Stability
+	card.Difficulty = s.Difficulty
+	card.Box = s.Box
+	card.Step = s.Step
+	card.Leech = s.Leech
+	card.Suspended = s.Suspended
+	card.Correct = s.Correct
+	card.Incorrect = s.Incorrect
+	card.LastReviewDate = s.LastReviewDate
+	card.ReviewDueDate = s.ReviewDueDate
+	return card
 }
 
 type Database interface {
-	createDeck(name string) error
+	createDeck(name string, scheduler string, parentID uint) error
 	createCard(card Card) error
+	createCardPair(card Card) error
+	addReverseCard(card Card) error
 	getCardByID(id uint) (Card, error)
+	updateCard(card Card) error
 	getAllCardsByDeckID(id uint) ([]Card, error)
 	getRandomCardsByDeckID(id uint) ([]Card, error)
 	getLearningCardsByDeckID(id uint) ([]Card, error)
 	getReviewCardsByDeckID(id uint) ([]Card, error)
 	getDueReviewCardsByDeckID(id uint) ([]Card, error)
+	getMostDueLearningCardByDeckID(id uint, tags []string) (Card, error)
+	getMostDueReviewCardByDeckID(id uint, tags []string) (Card, error)
+	getOrCreateTags(names []string) ([]Tag, error)
+	getTagsByDeckID(id uint) ([]Tag, error)
+	searchCards(search SearchQuery) ([]Card, error)
+	getLeechCards() ([]Card, error)
+	suspendCardByID(id uint) error
+	unsuspendCardByID(id uint) error
+	buryCardByID(id uint) error
+	unburyCardByID(id uint) error
+	bulkUpdateCards(ids []uint, action BulkAction) error
 	getDeckByID(id uint) (Deck, error)
 	selectAllDecks() ([]Deck, error)
-	updateLearningCardByID(card Card) error
-	updateReviewCardByID(card Card) error
+	updateDeckOptions(deck Deck) error
+	updateDeckFSRSWeights(id uint, weights string) error
+	renameDeck(id uint, name string) error
+	setDeckParent(id uint, parentID uint) error
+	deleteDeck(id uint, moveTo uint) error
+	duplicateDeck(id uint) (Deck, error)
+	mergeDecks(sourceID uint, targetID uint, resolution string) error
+	getReviewLogsByDeckID(id uint) ([]ReviewLog, error)
+	updateLearningCardByID(id uint, grade Grade) error
+	updateReviewCardByID(id uint, grade Grade) error
+	revertLastReview(id uint, grade Grade) (Card, error)
+	acceptAnswer(id uint, answer string) (Card, error)
 	deleteCardByID(card Card) error
+	restoreCardByID(id uint) (Card, error)
+	purgeDeletedCards(before time.Time) (int64, error)
 }
 
 type GormDB struct {
 	db *gorm.DB
+	// fts is set if the cards_fts search index exists. Without it searches
+	// fall back to LIKE.
+	fts bool
 }
 
-func (g *GormDB) createDeck(name string) error {
+func (g *GormDB) createDeck(name string, scheduler string, parentID uint) error {
 	var deck Deck
 	deck.Name = name
+	deck.Scheduler = scheduler
+	deck.ParentID = parentID
 	return g.db.Create(&deck).Error
 }
 
 func (g *GormDB) createCard(card Card) error {
-	return g.db.Create(&card).Error
+	err := g.db.Create(&card).Error
+	if err != nil {
+		return err
+	}
+	return g.reindexCards([]uint{card.ID})
+}
+
+// createCardPair creates a card together with its reverse.
+func (g *GormDB) createCardPair(card Card) error {
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&card).Error
+		if err != nil {
+			return err
+		}
+		return g.createReverse(tx, card)
+	})
+}
+
+// addReverseCard creates the reverse of a card that has none yet.
+func (g *GormDB) addReverseCard(card Card) error {
+	if card.SiblingID != 0 {
+		return fmt.Errorf("card %d already has a reverse", card.ID)
+	}
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		return g.createReverse(tx, card)
+	})
+}
+
+// createReverse creates the reverse of card and links the two as siblings.
+func (g *GormDB) createReverse(tx *gorm.DB, card Card) error {
+	reverse := reverseCard(card, time.Now().UTC())
+	err := tx.Create(&reverse).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Model(&Card{}).Where("id = ?", card.ID).Update("sibling_id", reverse.ID).Error
+	if err != nil || !g.fts {
+		return err
+	}
+	return indexCards(tx, []uint{card.ID, reverse.ID})
+}
+
+// reverseCard returns a new card that asks for the question of card by its
+// answer.
+func reverseCard(card Card, now time.Time) Card {
+	return resetScheduling(Card{
+		DeckID:      card.DeckID,
+		Question:    reverseQuestion(card),
+		Answer:      card.Question,
+		Notes:       card.Notes,
+		Tags:        card.Tags,
+		CardCreated: now,
+		SiblingID:   card.ID,
+	}, now)
+}
+
+// reverseQuestion returns the question of the reverse of card, which is the
+// first accepted answer of card. The other answers are synonyms the reverse
+// card can't ask for.
+func reverseQuestion(card Card) string {
+	answers := card.Answers()
+	if len(answers) == 0 {
+		return card.Answer
+	}
+	return answers[0]
+}
+
+// reverseAnswers returns the accepted answers of sibling with the first one
+// replaced by question, so that synonyms added to the sibling are kept.
+func reverseAnswers(sibling Card, question string) string {
+	answers := sibling.Answers()
+	if len(answers) == 0 {
+		return question
+	}
+	answers[0] = question
+	return joinAnswers(parseAnswers(answers))
+}
+
+// reindexCards updates the search index entries of cards, see indexCards.
+func (g *GormDB) reindexCards(ids []uint) error {
+	if !g.fts {
+		return nil
+	}
+	return indexCards(g.db, ids)
 }
 
 func (g *GormDB) getCardByID(id uint) (Card, error) {
 	var card Card
-	err := g.db.First(&card, id).Error
+	err := g.db.Preload("Tags").First(&card, id).Error
+	return card, err
+}
+
+// updateCard saves the card and replaces its tags with card.Tags. The
+// content of a sibling is kept in step, its scheduling is left alone. Either
+// card keeps the leech tag only if it is a leech.
+func (g *GormDB) updateCard(card Card) error {
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		return g.updateCardTx(tx, card)
+	})
+}
+
+// updateCardTx is updateCard within the transaction tx.
+func (g *GormDB) updateCardTx(tx *gorm.DB, card Card) error {
+	err := saveCardContent(tx, card)
+	if err != nil {
+		return err
+	}
+	ids := []uint{card.ID}
+
+	if card.SiblingID != 0 {
+		var sibling Card
+		result := tx.Limit(1).Find(&sibling, card.SiblingID)
+		if result.Error != nil {
+			return result.Error
+		}
+		// a deleted sibling is left as it was
+		if result.RowsAffected > 0 {
+			sibling.DeckID = card.DeckID
+			sibling.Question = reverseQuestion(card)
+			sibling.Answer = reverseAnswers(sibling, card.Question)
+			sibling.Notes = card.Notes
+			sibling.Tags = card.Tags
+			err = saveCardContent(tx, sibling)
+			if err != nil {
+				return err
+			}
+			// the leech tag belongs to the card that is the leech
+			err = g.syncLeechTag(tx, []uint{sibling.ID}, sibling.Leech)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, sibling.ID)
+		}
+	}
+	err = g.syncLeechTag(tx, []uint{card.ID}, card.Leech)
+	if err != nil {
+		return err
+	}
+
+	if g.fts {
+		return indexCards(tx, ids)
+	}
+	return nil
+}
+
+func saveCardContent(tx *gorm.DB, card Card) error {
+	err := tx.Omit("Tags").Save(&card).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&card).Association("Tags").Replace(card.Tags)
+}
+
+func (g *GormDB) getOrCreateTags(names []string) ([]Tag, error) {
+	tags := make([]Tag, len(names))
+	for i, name := range names {
+		err := g.db.Where(Tag{Name: name}).FirstOrCreate(&tags[i]).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// getTagsByDeckID returns the tags used by the cards of a deck.
+func (g *GormDB) getTagsByDeckID(id uint) ([]Tag, error) {
+	var tags []Tag
+	err := g.db.Distinct("tags.id", "tags.name").
+		Joins("JOIN card_tags ON card_tags.tag_id = tags.id").
+		Joins("JOIN cards ON cards.id = card_tags.card_id").
+		Where("cards.deck_id = ? AND cards.deleted_at IS NULL", id).
+		Order("tags.name").Find(&tags).Error
+	return tags, err
+}
+
+// taggedWith keeps the cards that have at least one of the tags. Without
+// tags it keeps every card.
+func taggedWith(tags []string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(tags) == 0 {
+			return db
+		}
+		tagged := db.Session(&gorm.Session{NewDB: true}).Table("card_tags").
+			Select("card_tags.card_id").
+			Joins("JOIN tags ON tags.id = card_tags.tag_id").
+			Where("tags.name IN ?", tags)
+		return db.Where("cards.id IN (?)", tagged)
+	}
+}
+
+// deleteCardByID only marks the card as deleted, which hides it from every
+// query until it is restored or purged.
+func (g *GormDB) deleteCardByID(card Card) error {
+	return g.db.Delete(&card).Error
+}
+
+func (g *GormDB) restoreCardByID(id uint) (Card, error) {
+	var card Card
+	err := g.db.Unscoped().Model(&Card{}).Where("id = ?", id).Update("deleted_at", nil).Error
+	if err != nil {
+		return card, err
+	}
+	err = g.db.Preload("Tags").First(&card, id).Error
 	return card, err
 }
 
+// purgeDeletedCards removes cards that were deleted before the given time
+// and their review logs for good. It returns the number of purged cards.
+func (g *GormDB) purgeDeletedCards(before time.Time) (int64, error) {
+	var purged int64
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		deleted := tx.Unscoped().Model(&Card{}).Select("id").Where("deleted_at IS NOT NULL AND deleted_at <= ?", before)
+		err := tx.Where("card_id IN (?)", deleted).Delete(&ReviewLog{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Exec("DELETE FROM card_tags WHERE card_id IN (?)", deleted).Error
+		if err != nil {
+			return err
+		}
+		// siblings that are deleted themselves can still be restored
+		err = tx.Unscoped().Model(&Card{}).Where("sibling_id IN (?)", deleted).Update("sibling_id", 0).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at <= ?", before).Delete(&Card{})
+		purged = result.RowsAffected
+		if result.Error != nil || !g.fts {
+			return result.Error
+		}
+		return tx.Exec("DELETE FROM cards_fts WHERE rowid NOT IN (SELECT id FROM cards)").Error
+	})
+	return purged, err
+}
+
 func (g *GormDB) getAllCardsByDeckID(id uint) ([]Card, error) {
 	var cards []Card
-	err := g.db.Where("deck_id = ?", id).Find(&cards).Error
+	err := g.db.Preload("Tags").Where("deck_id = ?", id).Find(&cards).Error
+	return cards, err
+}
+
+// maximumSearchResults limits how many cards a search returns.
+const maximumSearchResults = 200
+
+// searchCards returns the cards that match a search across all decks, the
+// best matches first if the search index is available.
+func (g *GormDB) searchCards(search SearchQuery) ([]Card, error) {
+	db := g.db.Preload("Tags").Limit(maximumSearchResults)
+
+	if len(search.Terms) > 0 && g.fts {
+		db = db.Joins("JOIN cards_fts ON cards_fts.rowid = cards.id").
+			Where("cards_fts MATCH ?", ftsMatch(search.Terms)).
+			Order("cards_fts.rank")
+	} else {
+		for _, term := range search.Terms {
+			like := likeContains(term)
+			tagged := g.db.Table("card_tags").Select("card_tags.card_id").
+				Joins("JOIN tags ON tags.id = card_tags.tag_id").
+				Where(`tags.name LIKE ? ESCAPE '\'`, like)
+			db = db.Where(`cards.question LIKE ? ESCAPE '\' OR cards.answer LIKE ? ESCAPE '\' OR cards.notes LIKE ? ESCAPE '\' OR cards.id IN (?)`, like, like, like, tagged)
+		}
+		db = db.Order("cards.id")
+	}
+
+	if search.Deck != "" {
+		decks, err := g.selectAllDecks()
+		if err != nil {
+			return nil, err
+		}
+		paths := deckPaths(decks)
+		deckIDs := []uint{}
+		for _, deck := range decks {
+			if strings.EqualFold(deck.Name, search.Deck) || strings.EqualFold(paths[deck.ID], search.Deck) {
+				deckIDs = append(deckIDs, subtreeDeckIDs(decks, deck.ID)...)
+			}
+		}
+		db = db.Where("cards.deck_id IN ?", deckIDs)
+	}
+	if search.Stage != "" {
+		db = db.Where("cards.stage = ?", search.Stage)
+	}
+	if len(search.Tags) > 0 {
+		db = db.Scopes(taggedWith(search.Tags))
+	}
+	if !search.DueFrom.IsZero() {
+		db = db.Where("cards.review_due_date >= ?", search.DueFrom)
+	}
+	if !search.DueUntil.IsZero() {
+		db = db.Where("cards.review_due_date < ?", search.DueUntil)
+	}
+
+	var cards []Card
+	err := db.Find(&cards).Error
+	return cards, err
+}
+
+// cardsPerPage is how many cards the deck page lists at once.
+const cardsPerPage = 50
+
+// CardSort is a way to order the cards listed on the deck page.
+type CardSort struct {
+	Name  string
+	Label string
+	Order string
+}
+
+var cardSorts = []CardSort{
+	{Name: "due", Label: "Due date", Order: "review_due_date"},
+	{Name: "created", Label: "Created", Order: "card_created"},
+	{Name: "ratio", Label: "Correct ratio", Order: "CAST(correct AS REAL) / MAX(correct + incorrect, 1)"},
+	{Name: "lapses", Label: "Lapses", Order: "lapses"},
+}
+
+var cardStages = []string{"learning", "review", "relearning"}
+
+// CardListOptions are the filters, order and page of the cards listed on the
+// deck page.
+type CardListOptions struct {
+	Tags       []string
+	Stage      string
+	Sort       string
+	Descending bool
+	Page       int
+}
+
+// parseCardListOptions reads the options of a card list from a query string.
+// Unknown values fall back to every stage, ordered by due date, on the first page.
+func parseCardListOptions(query url.Values) CardListOptions {
+	options := CardListOptions{
+		Tags:       query["tag"],
+		Stage:      query.Get("stage"),
+		Sort:       query.Get("sort"),
+		Descending: query.Get("order") == "desc",
+	}
+	if !slices.Contains(cardStages, options.Stage) {
+		options.Stage = ""
+	}
+	if !slices.ContainsFunc(cardSorts, func(sort CardSort) bool { return sort.Name == options.Sort }) {
+		options.Sort = "due"
+	}
+	options.Page, _ = strconv.Atoi(query.Get("page"))
+	if options.Page < 1 {
+		options.Page = 1
+	}
+	return options
+}
+
+// Query returns the options as a query string, leaving out the defaults.
+func (o CardListOptions) Query() string {
+	values := url.Values{}
+	if len(o.Tags) > 0 {
+		values["tag"] = o.Tags
+	}
+	if o.Stage != "" {
+		values.Set("stage", o.Stage)
+	}
+	if o.Sort != "due" {
+		values.Set("sort", o.Sort)
+	}
+	if o.Descending {
+		values.Set("order", "desc")
+	}
+	if o.Page > 1 {
+		values.Set("page", strconv.Itoa(o.Page))
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
+
+// listedCards keeps the cards of a deck that pass the filters of options and
+// orders them.
+func listedCards(deckID uint, options CardListOptions) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(taggedWith(options.Tags)).Where("deck_id = ?", deckID)
+		if options.Stage != "" {
+			db = db.Where("stage = ?", options.Stage)
+		}
+		for _, sort := range cardSorts {
+			if sort.Name == options.Sort && options.Descending {
+				db = db.Order(sort.Order + " DESC")
+			} else if sort.Name == options.Sort {
+				db = db.Order(sort.Order)
+			}
+		}
+		return db.Order("id")
+	}
+}
+
+func (g *GormDB) countListedCards(deckID uint, options CardListOptions) (int64, error) {
+	var count int64
+	err := g.db.Model(&Card{}).Scopes(listedCards(deckID, options)).Count(&count).Error
+	return count, err
+}
+
+// getListedCards returns the cards on the page of options.
+func (g *GormDB) getListedCards(deckID uint, options CardListOptions) ([]Card, error) {
+	var cards []Card
+	err := g.db.Preload("Tags").Scopes(listedCards(deckID, options)).
+		Offset((options.Page - 1) * cardsPerPage).Limit(cardsPerPage).Find(&cards).Error
 	return cards, err
 }
 
+// inRotation leaves out suspended cards and cards that are buried until later.
+func inRotation(db *gorm.DB) *gorm.DB {
+	return db.Where("suspended = ? AND buried_until <= ?", false, time.Now().UTC())
+}
+
+// siblingNotStudiedToday leaves out cards whose sibling was studied today, so
+// that one direction of a pair doesn't give away the other. They are back the
+// next day, like buried cards.
+func siblingNotStudiedToday(db *gorm.DB) *gorm.DB {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	studied := db.Session(&gorm.Session{NewDB: true}).Model(&Card{}).Select("id").Where("last_review_date >= ?", today)
+	return db.Where("cards.sibling_id NOT IN (?)", studied)
+}
+
 func (g *GormDB) getRandomCardsByDeckID(deckID uint, cardID uint) ([]Card, error) {
+	deckIDs, err := g.getSubtreeDeckIDs(deckID)
+	if err != nil {
+		return nil, err
+	}
+
 	var count int64
-	cardCountError := g.db.Model(&Card{}).Where("deck_id = ?", deckID).Count(&count).Error
+	cardCountError := g.db.Model(&Card{}).Scopes(inRotation).Where("deck_id IN ?", deckIDs).Count(&count).Error
 	if cardCountError != nil {
 		return nil, cardCountError
 	}
@@ -95,15 +710,40 @@ func (g *GormDB) getRandomCardsByDeckID(deckID uint, cardID uint) ([]Card, error
 		limit = 0
 	}
 
+	// the answer of the card's sibling is the question, so it is no distractor
+	var siblingID uint
+	err = g.db.Model(&Card{}).Select("sibling_id").Where("id = ?", cardID).Scan(&siblingID).Error
+	if err != nil {
+		return nil, err
+	}
+
 	var cards []Card
-	err := g.db.Where("deck_id = ? AND id != ?", deckID, cardID).Order("RANDOM()").Limit(limit).Find(&cards).Error
+	err = g.db.Scopes(inRotation).Where("deck_id IN ? AND id != ? AND id != ?", deckIDs, cardID, siblingID).Order("RANDOM()").Limit(limit).Find(&cards).Error
 
 	return cards, err
 }
 
+func learningCards(deckIDs []uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("deck_id IN ? AND stage = ?", deckIDs, "learning")
+	}
+}
+
+func dueReviewCards(deckIDs []uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("deck_id IN ? AND stage IN ? AND review_due_date <= ?", deckIDs, []string{"review", "relearning"}, time.Now().UTC())
+	}
+}
+
+// getLearningCardsByDeckID returns the learning cards of a deck and all of its subdecks.
 func (g *GormDB) getLearningCardsByDeckID(id uint) ([]Card, error) {
+	deckIDs, err := g.getSubtreeDeckIDs(id)
+	if err != nil {
+		return nil, err
+	}
+
 	var cards []Card
-	err := g.db.Where("deck_id = ? AND stage = ?", id, "learning").Find(&cards).Error
+	err = g.db.Scopes(inRotation, siblingNotStudiedToday, learningCards(deckIDs)).Find(&cards).Error
 	return cards, err
 }
 func (g *GormDB) getReviewCardsByDeckID(id uint) ([]Card, error) {
@@ -111,786 +751,2618 @@ func (g *GormDB) getReviewCardsByDeckID(id uint) ([]Card, error) {
 	err := g.db.Where("deck_id = ? AND stage = ?", id, "review").Find(&cards).Error
 	return cards, err
 }
+
+// getDueReviewCardsByDeckID returns the due review cards of a deck and all of its subdecks.
 func (g *GormDB) getDueReviewCardsByDeckID(id uint) ([]Card, error) {
-	now := time.Now().UTC()
+	deckIDs, err := g.getSubtreeDeckIDs(id)
+	if err != nil {
+		return nil, err
+	}
 
 	var cards []Card
-	err := g.db.Where("deck_id = ? AND stage = ? AND review_due_date <= ?", id, "review", now).Find(&cards).Error
+	err = g.db.Scopes(inRotation, siblingNotStudiedToday, dueReviewCards(deckIDs)).Find(&cards).Error
 	return cards, err
 }
 
-func (g *GormDB) getDeckByID(id uint) (Deck, error) {
-	var deck Deck
-	err := g.db.First(&deck, id).Error
-	return deck, err
+// getMostDueCard returns the card in scope that has been due the longest.
+// Relearning cards come before all others. Cards whose sibling was studied
+// today are skipped.
+func (g *GormDB) getMostDueCard(scopes ...func(db *gorm.DB) *gorm.DB) (Card, error) {
+	var card Card
+	result := g.db.Scopes(inRotation, siblingNotStudiedToday).Scopes(scopes...).Order("stage = 'relearning' DESC").Order("review_due_date").Limit(1).Find(&card)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return card, gorm.ErrRecordNotFound
+	}
+	return card, result.Error
 }
 
-func (g *GormDB) selectAllDecks() ([]Deck, error) {
-	var decks []Deck
-	err := g.db.Find(&decks).Error
-	return decks, err
+// getMostDueLearningCardByDeckID returns the most due learning card of a
+// deck and its subdecks that has one of the tags, or any tag if there are none.
+func (g *GormDB) getMostDueLearningCardByDeckID(id uint, tags []string) (Card, error) {
+	deckIDs, err := g.getSubtreeDeckIDs(id)
+	if err != nil {
+		return Card{}, err
+	}
+	return g.getMostDueCard(learningCards(deckIDs), taggedWith(tags))
 }
 
-func (g *GormDB) updateLearningCardByID(id uint, correct bool) error {
-	card, _ := g.getCardByID(id)
-
-	now := time.Now().UTC().Format(time.RFC3339Nano)
+func (g *GormDB) getMostDueReviewCardByDeckID(id uint, tags []string) (Card, error) {
+	deckIDs, err := g.getSubtreeDeckIDs(id)
+	if err != nil {
+		return Card{}, err
+	}
+	return g.getMostDueCard(dueReviewCards(deckIDs), taggedWith(tags))
+}
 
-	minuteAfter := time.Now().UTC().Add(time.Minute * time.Duration(1)).Format(time.RFC3339Nano)
+// countCardsByDeck counts the cards in scope of every deck.
+func (g *GormDB) countCardsByDeck(scope func(db *gorm.DB) *gorm.DB) (map[uint]int64, error) {
+	var rows []struct {
+		DeckID uint
+		Count  int64
+	}
+	err := g.db.Model(&Card{}).Scopes(inRotation, siblingNotStudiedToday, scope).Select("deck_id, count(*) AS count").Group("deck_id").Scan(&rows).Error
 
-	dayAfter := time.Now().UTC().Add(time.Hour * time.Duration(24)).Format(time.RFC3339Nano)
+	counts := map[uint]int64{}
+	for _, row := range rows {
+		counts[row.DeckID] = row.Count
+	}
+	return counts, err
+}
 
-	card.LastReviewDate = string(now)
-	if correct {
-		card.Correct++
-		if card.Ease > 1 {
-			card.Ease = uint(getNextEaseLevel(int(card.Ease), 1))
-			card.Stage = "review"
-			card.ReviewDueDate = string(dayAfter)
+// getDeckTree returns every deck arranged by parent, counting the due review
+// and new cards of each deck together with its subdecks.
+func (g *GormDB) getDeckTree() ([]DeckNode, error) {
+	decks, err := g.selectAllDecks()
+	if err != nil {
+		return nil, err
+	}
+	deckIDs := make([]uint, len(decks))
+	for i, deck := range decks {
+		deckIDs[i] = deck.ID
+	}
 
-		} else {
-			card.Ease = uint(getNextEaseLevel(int(card.Ease), 2))
-			card.ReviewDueDate = string(minuteAfter)
-		}
-	} else {
-		card.Incorrect++
-		card.Ease = 1
-		card.ReviewDueDate = string(minuteAfter)
+	due, err := g.countCardsByDeck(dueReviewCards(deckIDs))
+	if err != nil {
+		return nil, err
+	}
+	learning, err := g.countCardsByDeck(learningCards(deckIDs))
+	if err != nil {
+		return nil, err
 	}
-	return g.db.Save(&card).Error
+	return buildDeckTree(decks, due, learning), nil
 }
 
-func (g *GormDB) updateReviewCardByID(id uint, correct bool) error {
-	card, _ := g.getCardByID(id)
+func (g *GormDB) getLeechCards() ([]Card, error) {
+	var cards []Card
+	err := g.db.Where("leech = ?", true).Order("lapses DESC").Find(&cards).Error
+	return cards, err
+}
 
-	now := time.Now().UTC().Format(time.RFC3339Nano)
+func (g *GormDB) suspendCardByID(id uint) error {
+	return g.db.Model(&Card{}).Where("id = ?", id).Update("suspended", true).Error
+}
 
-	minuteAfter := time.Now().UTC().Add(time.Minute * time.Duration(1)).Format(time.RFC3339Nano)
+func (g *GormDB) unsuspendCardByID(id uint) error {
+	return g.db.Model(&Card{}).Where("id = ?", id).Update("suspended", false).Error
+}
 
-	card.LastReviewDate = string(now)
-	if correct {
-		card.Correct++
-		card.ReviewDueDate = createNextReviewDueDate(int(card.Ease))
-		card.Ease = uint(getNextEaseLevel(int(card.Ease), 2))
-	} else {
-		card.Incorrect++
-		card.ReviewDueDate = string(minuteAfter)
-		if card.Ease != 1 {
-			card.Lapses++
-			card.Ease = 1
-		}
-	}
+// buryCardByID hides a card until the start of the next day.
+func (g *GormDB) buryCardByID(id uint) error {
+	tomorrow := startOfNextDay(time.Now().UTC())
+	return g.db.Model(&Card{}).Where("id = ?", id).Update("buried_until", tomorrow).Error
+}
 
-	return g.db.Save(&card).Error
+func (g *GormDB) unburyCardByID(id uint) error {
+	return g.db.Model(&Card{}).Where("id = ?", id).Update("buried_until", time.Time{}).Error
 }
 
-func startMessage() string {
-	return "Starting app..."
+// BulkAction is an action applied to many cards at once from the deck page.
+// DeckID is the deck cards are moved to, Tag the tag added or removed and Due
+// the date cards are rescheduled to.
+type BulkAction struct {
+	Name   string
+	DeckID uint
+	Tag    string
+	Due    time.Time
 }
 
-func HomeHandler(writer http.ResponseWriter, request *http.Request) {
+// bulkActionResults describes every bulk action once it is done.
+var bulkActionResults = map[string]string{
+	"move":       "Moved",
+	"add-tag":    "Tagged",
+	"remove-tag": "Untagged",
+	"suspend":    "Suspended",
+	"unsuspend":  "Unsuspended",
+	"reset":      "Reset",
+	"reschedule": "Rescheduled",
+	"delete":     "Deleted",
+	"restore":    "Restored",
+}
 
-	displayHome := func() {
-		tmpl, _ := template.ParseFiles("./templates/index.html", "./templates/navbar.html")
-		tmpl.Execute(writer, nil)
-	}
+// bulkUpdateCards applies an action to the cards with the given IDs. Either
+// every card is changed or none is. Moves and tag changes carry over to the
+// siblings of the cards, like edits of a single card do.
+func (g *GormDB) bulkUpdateCards(ids []uint, action BulkAction) error {
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		cards := tx.Model(&Card{}).Where("id IN ?", ids)
+
+		switch action.Name {
+		case "move", "add-tag", "remove-tag":
+			var err error
+			ids, err = withSiblings(tx, ids)
+			if err != nil {
+				return err
+			}
+		}
 
-	switch request.Method {
-	case "GET":
-		displayHome()
-	default:
-		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
+		switch action.Name {
+		case "move":
+			return moveCards(tx, ids, action.DeckID)
+		case "add-tag":
+			var tag Tag
+			err := tx.Where(Tag{Name: action.Tag}).FirstOrCreate(&tag).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Exec("INSERT OR IGNORE INTO card_tags (card_id, tag_id) SELECT id, ? FROM cards WHERE id IN ?", tag.ID, ids).Error
+			if err != nil || !g.fts {
+				return err
+			}
+			return indexCards(tx, ids)
+		case "remove-tag":
+			err := tx.Exec("DELETE FROM card_tags WHERE card_id IN ? AND tag_id IN (SELECT id FROM tags WHERE name = ?)", ids, action.Tag).Error
+			if err != nil || !g.fts {
+				return err
+			}
+			return indexCards(tx, ids)
+		case "suspend":
+			return cards.Update("suspended", true).Error
+		case "unsuspend":
+			return cards.Update("suspended", false).Error
+		case "reset":
+			var reset []Card
+			err := tx.Where("id IN ?", ids).Find(&reset).Error
+			if err != nil {
+				return err
+			}
+			now := time.Now().UTC()
+			for _, card := range reset {
+				card = resetScheduling(card, now)
+				err := tx.Omit("Tags").Save(&card).Error
+				if err != nil {
+					return err
+				}
+			}
+			return g.syncLeechTag(tx, ids, false)
+		case "reschedule":
+			return cards.Update("review_due_date", action.Due).Error
+		case "delete":
+			return tx.Delete(&Card{}, ids).Error
+		case "restore":
+			return tx.Unscoped().Model(&Card{}).Where("id IN ?", ids).Update("deleted_at", nil).Error
+		default:
+			return fmt.Errorf("unknown bulk action %q", action.Name)
+		}
+	})
+}
+
+// getSubtreeDeckIDs returns the ID of a deck followed by the IDs of all of its subdecks.
+func (g *GormDB) getSubtreeDeckIDs(id uint) ([]uint, error) {
+	decks, err := g.selectAllDecks()
+	if err != nil {
+		return nil, err
 	}
+	return subtreeDeckIDs(decks, id), nil
 }
 
-func (g *GormDB) CreateDeckHandler(writer http.ResponseWriter, request *http.Request) {
-	displayForm := func() {
-		tmpl, _ := template.ParseFiles("./templates/create_deck.html", "./templates/navbar.html")
-		data := struct {
-			Title   string
-			Heading string
-			Message string
+func (g *GormDB) setDeckParent(id uint, parentID uint) error {
+	return g.db.Model(&Deck{}).Where("id = ?", id).Update("parent_id", parentID).Error
+}
+
+func (g *GormDB) getDeckByID(id uint) (Deck, error) {
+	var deck Deck
+	err := g.db.First(&deck, id).Error
+	return deck, err
+}
+
+func (g *GormDB) selectAllDecks() ([]Deck, error) {
+	var decks []Deck
+	err := g.db.Find(&decks).Error
+	return decks, err
+}
+
+// updateDeckOptions saves the settings that can be changed on the deck options page.
+func (g *GormDB) updateDeckOptions(deck Deck) error {
+	return g.db.Model(&deck).Select(
+		"scheduler", "leitner_boxes",
+		"learning_steps", "relearning_steps", "graduating_interval", "easy_interval", "lapse_interval_percent",
+		"leech_threshold", "leech_action", "fuzz_percent", "load_balance", "create_reverse",
+		"typo_tolerance", "near_miss_policy", "diacritic_mode",
+	).Updates(&deck).Error
+}
+
+func (g *GormDB) updateDeckFSRSWeights(id uint, weights string) error {
+	return g.db.Model(&Deck{}).Where("id = ?", id).Update("fsrs_weights", weights).Error
+}
+
+func (g *GormDB) getReviewLogsByDeckID(id uint) ([]ReviewLog, error) {
+	var reviews []ReviewLog
+	err := g.db.Where("deck_id = ?", id).Order("card_id, reviewed").Find(&reviews).Error
+	return reviews, err
+}
+
+func (g *GormDB) renameDeck(id uint, name string) error {
+	return g.db.Model(&Deck{}).Where("id = ?", id).Update("name", name).Error
+}
+
+// withSiblings returns ids along with the IDs of the siblings of those cards.
+// Deleted siblings are left out.
+func withSiblings(tx *gorm.DB, ids []uint) ([]uint, error) {
+	var siblings []uint
+	siblingIDs := tx.Model(&Card{}).Select("sibling_id").Where("id IN ?", ids)
+	err := tx.Model(&Card{}).Where("id IN (?) AND id NOT IN ?", siblingIDs, ids).Pluck("id", &siblings).Error
+	if err != nil {
+		return nil, err
+	}
+	return append(slices.Clone(ids), siblings...), nil
+}
+
+// moveCards moves cards and their review history to another deck.
+func moveCards(tx *gorm.DB, cardIDs []uint, deckID uint) error {
+	if len(cardIDs) == 0 {
+		return nil
+	}
+	err := tx.Model(&Card{}).Where("id IN ?", cardIDs).Update("deck_id", deckID).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&ReviewLog{}).Where("card_id IN ?", cardIDs).Update("deck_id", deckID).Error
+}
+
+// deleteDeck deletes a deck. Its cards are moved to the deck moveTo, or
+// deleted like single cards if moveTo is 0. Its subdecks move up a level.
+func (g *GormDB) deleteDeck(id uint, moveTo uint) error {
+	deck, err := g.getDeckByID(id)
+	if err != nil {
+		return err
+	}
+
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Deck{}).Where("parent_id = ?", id).Update("parent_id", deck.ParentID).Error
+		if err != nil {
+			return err
+		}
+
+		if moveTo != 0 {
+			var cardIDs []uint
+			err := tx.Model(&Card{}).Where("deck_id = ?", id).Pluck("id", &cardIDs).Error
+			if err != nil {
+				return err
+			}
+			err = moveCards(tx, cardIDs, moveTo)
+			if err != nil {
+				return err
+			}
+		} else {
+			err := tx.Where("deck_id = ?", id).Delete(&Card{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&Deck{}, id).Error
+	})
+}
+
+// duplicateDeck copies a deck with its options and cards. The copied cards
+// start over as new cards.
+func (g *GormDB) duplicateDeck(id uint) (Deck, error) {
+	deck, err := g.getDeckByID(id)
+	if err != nil {
+		return deck, err
+	}
+	cards, err := g.getAllCardsByDeckID(id)
+	if err != nil {
+		return deck, err
+	}
+
+	duplicate := deck
+	duplicate.ID = 0
+	duplicate.Name = deck.Name + " (copy)"
+	var copiedIDs []uint
+	copies := map[uint]uint{}
+
+	err = g.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&duplicate).Error
+		if err != nil {
+			return err
+		}
+		// Create leaves out zero values in favour of the column defaults
+		err = tx.Model(&duplicate).Select("*").Omit("id").Updates(&duplicate).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		for _, card := range cards {
+			copied := resetScheduling(Card{
+				DeckID:      duplicate.ID,
+				Question:    card.Question,
+				Answer:      card.Answer,
+				Notes:       card.Notes,
+				Tags:        card.Tags,
+				CardCreated: now,
+			}, now)
+			err := tx.Create(&copied).Error
+			if err != nil {
+				return err
+			}
+			copiedIDs = append(copiedIDs, copied.ID)
+			copies[card.ID] = copied.ID
+		}
+		// copied siblings are linked to each other
+		for _, card := range cards {
+			sibling, ok := copies[card.SiblingID]
+			if !ok {
+				continue
+			}
+			err := tx.Model(&Card{}).Where("id = ?", copies[card.ID]).Update("sibling_id", sibling).Error
+			if err != nil {
+				return err
+			}
+		}
+		if g.fts && len(copiedIDs) > 0 {
+			return indexCards(tx, copiedIDs)
+		}
+		return nil
+	})
+	return duplicate, err
+}
+
+// mergeDecks moves the cards and subdecks of the source deck into the target
+// deck and deletes the source deck. Questions that are in both decks are
+// resolved as described by resolveDuplicates.
+func (g *GormDB) mergeDecks(sourceID uint, targetID uint, resolution string) error {
+	if sourceID == targetID {
+		return fmt.Errorf("a deck can't be merged into itself")
+	}
+	subtree, err := g.getSubtreeDeckIDs(sourceID)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(subtree, targetID) {
+		return fmt.Errorf("a deck can't be merged into one of its subdecks")
+	}
+
+	source, err := g.getAllCardsByDeckID(sourceID)
+	if err != nil {
+		return err
+	}
+	target, err := g.getAllCardsByDeckID(targetID)
+	if err != nil {
+		return err
+	}
+	move, remove := resolveDuplicates(source, target, resolution)
+
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		err := moveCards(tx, cardIDs(move), targetID)
+		if err != nil {
+			return err
+		}
+		if len(remove) > 0 {
+			err = tx.Delete(&Card{}, cardIDs(remove)).Error
+			if err != nil {
+				return err
+			}
+		}
+		err = tx.Model(&Deck{}).Where("parent_id = ?", sourceID).Update("parent_id", targetID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&Deck{}, sourceID).Error
+	})
+}
+
+// DeckNode is a deck in the deck tree. Due and New count the cards of the
+// deck and all of its subdecks.
+type DeckNode struct {
+	Deck     Deck
+	Due      int64
+	New      int64
+	Children []DeckNode
+}
+
+// deckChildren groups decks by parent. Decks whose parent does not exist are
+// treated as top-level decks.
+func deckChildren(decks []Deck) map[uint][]Deck {
+	exists := map[uint]bool{}
+	for _, deck := range decks {
+		exists[deck.ID] = true
+	}
+
+	children := map[uint][]Deck{}
+	for _, deck := range decks {
+		parentID := deck.ParentID
+		if !exists[parentID] {
+			parentID = 0
+		}
+		children[parentID] = append(children[parentID], deck)
+	}
+	return children
+}
+
+func buildDeckTree(decks []Deck, due map[uint]int64, learning map[uint]int64) []DeckNode {
+	children := deckChildren(decks)
+
+	var build func(parentID uint) []DeckNode
+	build = func(parentID uint) []DeckNode {
+		var nodes []DeckNode
+		for _, deck := range children[parentID] {
+			node := DeckNode{Deck: deck, Due: due[deck.ID], New: learning[deck.ID], Children: build(deck.ID)}
+			for _, child := range node.Children {
+				node.Due += child.Due
+				node.New += child.New
+			}
+			nodes = append(nodes, node)
+		}
+		return nodes
+	}
+	return build(0)
+}
+
+// subtreeDeckIDs returns id followed by the IDs of every deck below it.
+func subtreeDeckIDs(decks []Deck, id uint) []uint {
+	children := deckChildren(decks)
+
+	ids := []uint{id}
+	seen := map[uint]bool{id: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if !seen[child.ID] {
+				seen[child.ID] = true
+				ids = append(ids, child.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// deckPaths names every deck by its path from the top of the tree, like
+// "Spanish::Verbs::Irregular".
+func deckPaths(decks []Deck) map[uint]string {
+	byID := map[uint]Deck{}
+	for _, deck := range decks {
+		byID[deck.ID] = deck
+	}
+
+	paths := map[uint]string{}
+	for _, deck := range decks {
+		path := deck.Name
+		parent, ok := byID[deck.ParentID]
+		// the depth is bounded in case the parents form a cycle
+		for depth := 0; ok && depth < len(decks); depth++ {
+			path = parent.Name + "::" + path
+			parent, ok = byID[parent.ParentID]
+		}
+		paths[deck.ID] = path
+	}
+	return paths
+}
+
+func cardIDs(cards []Card) []uint {
+	ids := make([]uint, len(cards))
+	for i, card := range cards {
+		ids[i] = card.ID
+	}
+	return ids
+}
+
+// Ways to resolve a question that is in both decks of a merge.
+var mergeResolutions = []string{"keep-both", "keep-target", "keep-source", "keep-further"}
+
+// resolveDuplicates decides which cards of the source deck of a merge move to
+// the target deck and which cards of either deck are deleted. Questions are
+// compared ignoring case and surrounding space. Unless resolution is
+// keep-both, one card of each duplicate question is deleted: the source card
+// for keep-target, the target card for keep-source and the card with the
+// shorter interval for keep-further.
+func resolveDuplicates(source []Card, target []Card, resolution string) (move []Card, remove []Card) {
+	targetCards := map[string]Card{}
+	for _, card := range target {
+		question := strings.ToLower(strings.TrimSpace(card.Question))
+		if _, ok := targetCards[question]; !ok {
+			targetCards[question] = card
+		}
+	}
+
+	// several source cards can duplicate the same target card, which is
+	// removed only once
+	removed := map[uint]bool{}
+	for _, card := range source {
+		duplicate, ok := targetCards[strings.ToLower(strings.TrimSpace(card.Question))]
+		if !ok || resolution == "keep-both" {
+			move = append(move, card)
+			continue
+		}
+
+		keepSource := resolution == "keep-source" || (resolution == "keep-further" && card.Interval > duplicate.Interval)
+		if keepSource {
+			move = append(move, card)
+			if !removed[duplicate.ID] {
+				removed[duplicate.ID] = true
+				remove = append(remove, duplicate)
+			}
+		} else {
+			remove = append(remove, card)
+		}
+	}
+	return move, remove
+}
+
+// scheduleCard runs the card through the scheduler of its deck, stores the
+// result and records the answer in the review log.
+func (g *GormDB) scheduleCard(card Card, grade Grade) error {
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		return g.scheduleCardTx(tx, card, grade)
+	})
+}
+
+// scheduleCardTx is scheduleCard within the transaction tx.
+func (g *GormDB) scheduleCardTx(tx *gorm.DB, card Card, grade Grade) error {
+	var deck Deck
+	err := tx.First(&deck, card.DeckID).Error
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	review := ReviewLog{
+		CardID:   card.ID,
+		DeckID:   card.DeckID,
+		Grade:    grade,
+		Stage:    card.Stage,
+		Reviewed: now,
+		Before:   schedulingStateOf(card),
+	}
+
+	lapses, leech := card.Lapses, card.Leech
+	card = schedulerFor(deck).Schedule(card, grade, now)
+	card.LastReviewDate = now
+	if card.Lapses > lapses {
+		card = markLeech(card, deck)
+	}
+	if card.Stage == "review" {
+		card = fuzzCard(tx, card, deck, now)
+	}
+	if grade == GradeAgain {
+		card.Incorrect++
+	} else {
+		card.Correct++
+	}
+
+	err = tx.Omit("Tags").Save(&card).Error
+	if err != nil {
+		return err
+	}
+	if card.Leech != leech {
+		err = g.syncLeechTag(tx, []uint{card.ID}, card.Leech)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Create(&review).Error
+}
+
+// fuzzCard moves the due date of a review card to a random day within the
+// deck's fuzz window, so that cards answered together do not stay together.
+// With load balancing the least busy day of the window is picked instead.
+// Decks without computed intervals are left alone, see fuzzesIntervals.
+func fuzzCard(db *gorm.DB, card Card, deck Deck, now time.Time) Card {
+	if !fuzzesIntervals(deck) {
+		return card
+	}
+	day := 24 * time.Hour
+	minimum, maximum := fuzzRange(card.Interval, deck.FuzzPercent)
+	if minimum == maximum {
+		return card
+	}
+
+	days := minimum + rand.Intn(maximum-minimum+1)
+	if deck.LoadBalance {
+		target := int(math.Round(card.Interval.Hours() / 24))
+		fewest := int64(-1)
+		for candidate := minimum; candidate <= maximum; candidate++ {
+			start := now.Add(time.Duration(candidate) * day).Truncate(day)
+			var count int64
+			err := db.Model(&Card{}).Where(
+				"deck_id = ? AND id != ? AND suspended = ? AND review_due_date >= ? AND review_due_date < ?",
+				card.DeckID, card.ID, false, start, start.Add(day),
+			).Count(&count).Error
+			if err != nil {
+				break
+			}
+			closer := absInt(candidate-target) < absInt(days-target)
+			if fewest < 0 || count < fewest || (count == fewest && closer) {
+				fewest = count
+				days = candidate
+			}
+		}
+	}
+
+	card.Interval = time.Duration(days) * day
+	card.ReviewDueDate = now.Add(card.Interval)
+	return card
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// markLeech flags a card that has lapsed as often as the deck's leech
+// threshold allows, and takes it out of rotation if the deck says so.
+// A threshold of zero turns leech detection off. scheduleCard adds the leech
+// tag to newly flagged cards.
+func markLeech(card Card, deck Deck) Card {
+	if deck.LeechThreshold == 0 || card.Lapses < deck.LeechThreshold {
+		return card
+	}
+	card.Leech = true
+	if deck.LeechAction == "suspend" {
+		card.Suspended = true
+	}
+	return card
+}
+
+// leechTag is the tag cards get when they turn into leeches, so that they can
+// be searched and studied like other tagged cards.
+const leechTag = "leech"
+
+// syncLeechTag adds the leech tag to the cards if leech is true and takes it
+// away otherwise, so that the tag follows Card.Leech.
+func (g *GormDB) syncLeechTag(tx *gorm.DB, ids []uint, leech bool) error {
+	var err error
+	if leech {
+		var tag Tag
+		err = tx.Where(Tag{Name: leechTag}).FirstOrCreate(&tag).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Exec("INSERT OR IGNORE INTO card_tags (card_id, tag_id) SELECT id, ? FROM cards WHERE id IN ?", tag.ID, ids).Error
+	} else {
+		err = tx.Exec("DELETE FROM card_tags WHERE card_id IN ? AND tag_id IN (SELECT id FROM tags WHERE name = ?)", ids, leechTag).Error
+	}
+	if err != nil || !g.fts {
+		return err
+	}
+	return indexCards(tx, ids)
+}
+
+// withoutLeechTag returns tags without the leech tag.
+func withoutLeechTag(tags []Tag) []Tag {
+	var kept []Tag
+	for _, tag := range tags {
+		if tag.Name != leechTag {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
+}
+
+// minimumFSRSReviews is how many scored reviews a deck needs before its
+// FSRS weights are fitted. With fewer the defaults predict better.
+const minimumFSRSReviews = 100
+
+// optimizeFSRSDecks fits the FSRS weights of every deck to its review history.
+func (g *GormDB) optimizeFSRSDecks() error {
+	decks, err := g.selectAllDecks()
+	if err != nil {
+		return err
+	}
+
+	for _, deck := range decks {
+		reviews, err := g.getReviewLogsByDeckID(deck.ID)
+		if err != nil {
+			return err
+		}
+		histories := groupReviewsByCard(reviews)
+
+		before, scored := fsrsLoss(defaultFSRSWeights, histories)
+		if scored < minimumFSRSReviews {
+			fmt.Printf("Skipping deck '%s': %d of %d reviews needed\n", deck.Name, scored, minimumFSRSReviews)
+			continue
+		}
+
+		weights := optimizeFSRSWeights(defaultFSRSWeights, histories, 300)
+		after, _ := fsrsLoss(weights, histories)
+
+		err = g.updateDeckFSRSWeights(deck.ID, formatFSRSWeights(weights))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Deck '%s': log loss %.4f -> %.4f over %d reviews\n", deck.Name, before, after, scored)
+	}
+	return nil
+}
+
+func (g *GormDB) updateLearningCardByID(id uint, grade Grade) error {
+	card, err := g.getCardByID(id)
+	if err != nil {
+		return err
+	}
+	return g.scheduleCard(card, grade)
+}
+
+func (g *GormDB) updateReviewCardByID(id uint, grade Grade) error {
+	card, err := g.getCardByID(id)
+	if err != nil {
+		return err
+	}
+	return g.scheduleCard(card, grade)
+}
+
+// errNoReviewToRevert is returned if the last review of a card can't be
+// reverted, because it got another grade or was logged without the state
+// before it.
+var errNoReviewToRevert = errors.New("the last review of this card can't be reverted")
+
+// revertLastReview puts a card back into the state it was in before its last
+// review, as long as that review got grade, and deletes the review. A leech
+// tag the review added is taken away again.
+func (g *GormDB) revertLastReview(id uint, grade Grade) (Card, error) {
+	var card Card
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		card, err = g.revertLastReviewTx(tx, id, grade)
+		return err
+	})
+	return card, err
+}
+
+// revertLastReviewTx is revertLastReview within the transaction tx.
+func (g *GormDB) revertLastReviewTx(tx *gorm.DB, id uint, grade Grade) (Card, error) {
+	var card Card
+	err := tx.Preload("Tags").First(&card, id).Error
+	if err != nil {
+		return card, err
+	}
+	var review ReviewLog
+	result := tx.Where("card_id = ?", id).Order("reviewed DESC, id DESC").Limit(1).Find(&review)
+	if result.Error != nil {
+		return card, result.Error
+	}
+	if result.RowsAffected == 0 || review.Grade != grade || review.Before.Stage == "" {
+		return card, errNoReviewToRevert
+	}
+
+	leech := card.Leech
+	card = review.Before.restore(card)
+	err = tx.Omit("Tags").Save(&card).Error
+	if err != nil {
+		return card, err
+	}
+	if card.Leech != leech {
+		err = g.syncLeechTag(tx, []uint{card.ID}, card.Leech)
+		if err != nil {
+			return card, err
+		}
+		if !card.Leech {
+			card.Tags = withoutLeechTag(card.Tags)
+		}
+	}
+	return card, tx.Delete(&review).Error
+}
+
+// acceptAnswer overrules a typed answer that was graded as wrong: the review
+// is reverted and the card graded as correct instead. A non-empty answer is
+// added to the accepted answers of the card. Either all of it happens or
+// nothing does.
+func (g *GormDB) acceptAnswer(id uint, answer string) (Card, error) {
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		card, err := g.revertLastReviewTx(tx, id, GradeAgain)
+		if err != nil {
+			return err
+		}
+		if answer != "" {
+			card.Answer = joinAnswers(parseAnswers([]string{card.Answer, answer}))
+			err = g.updateCardTx(tx, card)
+			if err != nil {
+				return err
+			}
+		}
+		return g.scheduleCardTx(tx, card, GradeGood)
+	})
+	if err != nil {
+		return Card{}, err
+	}
+	return g.getCardByID(id)
+}
+
+// resetScheduling turns the card back into a new card that is due at now. Its
+// content and its correct and incorrect counts are kept, it loses the leech
+// tag along with the leech flag.
+func resetScheduling(card Card, now time.Time) Card {
+	card.Stage = "learning"
+	card.Lapses = 0
+	card.Ease = 1
+	card.EaseFactor = 2.5
+	card.Repetitions = 0
+	card.Interval = 0
+	card.Stability = 0
+	card.Difficulty = 0
+	card.Box = 0
+	card.Step = 0
+	card.Leech = false
+	card.Tags = withoutLeechTag(card.Tags)
+	card.LastReviewDate = time.Time{}
+	card.ReviewDueDate = now
+	return card
+}
+
+func startOfNextDay(t time.Time) time.Time {
+	return t.Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+// IsBuried reports whether the card is hidden from study sessions for today.
+func (c Card) IsBuried() bool {
+	return c.BuriedUntil.After(time.Now().UTC())
+}
+
+func startMessage() string {
+	return "Starting app..."
+}
+
+func HomeHandler(writer http.ResponseWriter, request *http.Request) {
+
+	displayHome := func() {
+		tmpl, _ := template.ParseFiles("./templates/index.html", "./templates/navbar.html")
+		tmpl.Execute(writer, nil)
+	}
+
+	switch request.Method {
+	case "GET":
+		displayHome()
+	default:
+		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
+	}
+}
+
+func (g *GormDB) CreateDeckHandler(writer http.ResponseWriter, request *http.Request) {
+	displayForm := func() {
+		tmpl, _ := template.ParseFiles("./templates/create_deck.html", "./templates/navbar.html")
+		decks, _ := g.selectAllDecks()
+		data := struct {
+			Title      string
+			Heading    string
+			Message    string
+			Schedulers []string
+			Default    string
+			Decks      []Deck
+			Paths      map[uint]string
+		}{
+			Title:      "Deck Creation",
+			Heading:    "Create a deck",
+			Message:    "All you need to create a deck is a deck name. Duplicate deck names are allowed.",
+			Schedulers: schedulerNames(),
+			Default:    defaultScheduler,
+			Decks:      decks,
+			Paths:      deckPaths(decks),
+		}
+		tmpl.Execute(writer, data)
+	}
+	processForm := func() {
+		err := request.ParseForm()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		deckName := request.FormValue("deckname")
+		scheduler := request.FormValue("scheduler")
+		if _, ok := schedulers[scheduler]; !ok {
+			scheduler = defaultScheduler
+		}
+		parentID, _ := strconv.Atoi(request.FormValue("parent-id"))
+		g.createDeck(deckName, scheduler, uint(parentID))
+
+		fmt.Fprintf(writer, "<div id='result'>Deck '%s' created successfully!</div>", deckName)
+
+	}
+
+	switch request.Method {
+	case "GET":
+		displayForm()
+	case "POST":
+		processForm()
+	default:
+		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
+	}
+
+}
+
+func IsAnswerCorrectInLowerCase(userAnswer string, databaseAnswer string) bool {
+	return strings.EqualFold(strings.TrimSpace(userAnswer), (strings.TrimSpace(databaseAnswer)))
+}
+
+// DeckPage holds what the deck page shows. The card browser part of it is
+// rendered again after bulk actions. Query only holds the tag filter, which
+// study sessions share, List every option of the card list.
+type DeckPage struct {
+	Title   string
+	Deck    Deck
+	Decks   []Deck
+	Paths   map[uint]string
+	Cards   []Card
+	Boxes   []LeitnerBox
+	Chips   []TagChip
+	Query   string
+	Message string
+	List    CardListOptions
+	Sorts   []CardSort
+	Stages  []string
+	Total   int64
+	Pages   int
+}
+
+// SortQuery returns the query string that orders the list by sort, or
+// reverses the order if the list is already ordered by it.
+func (p DeckPage) SortQuery(sort string) string {
+	options := p.List
+	options.Descending = sort == options.Sort && !options.Descending
+	options.Sort = sort
+	options.Page = 1
+	return options.Query()
+}
+
+// StageQuery returns the query string that lists the cards in stage, or all
+// cards if stage is empty.
+func (p DeckPage) StageQuery(stage string) string {
+	options := p.List
+	options.Stage = stage
+	options.Page = 1
+	return options.Query()
+}
+
+func (p DeckPage) PageQuery(page int) string {
+	options := p.List
+	options.Page = page
+	return options.Query()
+}
+
+func (p DeckPage) PreviousPageQuery() string {
+	return p.PageQuery(p.List.Page - 1)
+}
+
+func (p DeckPage) NextPageQuery() string {
+	return p.PageQuery(p.List.Page + 1)
+}
+
+func (g *GormDB) getDeckPage(deck Deck, options CardListOptions) DeckPage {
+	total, _ := g.countListedCards(deck.ID, options)
+	pages := max(int(math.Ceil(float64(total)/cardsPerPage)), 1)
+	options.Page = min(options.Page, pages)
+	cards, _ := g.getListedCards(deck.ID, options)
+
+	var boxes []LeitnerBox
+	if deck.Scheduler == "leitner" {
+		allCards, _ := g.getAllCardsByDeckID(deck.ID)
+		boxes = leitnerBoxes(allCards, deck.LeitnerBoxes)
+	}
+	deckTags, _ := g.getTagsByDeckID(deck.ID)
+	decks, _ := g.selectAllDecks()
+
+	return DeckPage{
+		Title:  "Deck " + deck.Name,
+		Deck:   deck,
+		Decks:  decks,
+		Paths:  deckPaths(decks),
+		Cards:  cards,
+		Boxes:  boxes,
+		Chips:  tagChips(deckTags, options.Tags),
+		Query:  tagQuery(options.Tags),
+		List:   options,
+		Sorts:  cardSorts,
+		Stages: cardStages,
+		Total:  total,
+		Pages:  pages,
+	}
+}
+
+func (g *GormDB) DeckHandler(writer http.ResponseWriter, request *http.Request) {
+	IDString := strings.TrimPrefix(request.URL.Path, "/deck/")
+	id, _ := strconv.Atoi(IDString)
+	deck, _ := g.getDeckByID(uint(id))
+	options := parseCardListOptions(request.URL.Query())
+
+	displayCards := func() {
+		tmpl, _ := template.ParseFiles("./templates/deck.html", "./templates/navbar.html", "./templates/deck_cards.html", "./templates/htmx/card-row.html")
+		tmpl.Execute(writer, g.getDeckPage(deck, options))
+	}
+
+	switch request.Method {
+	case "GET":
+		displayCards()
+	default:
+		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
+	}
+
+}
+
+func (g *GormDB) DeckOptionsHandler(writer http.ResponseWriter, request *http.Request) {
+	IDString := strings.TrimPrefix(request.URL.Path, "/deck-options/")
+	id, _ := strconv.Atoi(IDString)
+	deck, err := g.getDeckByID(uint(id))
+	if err != nil {
+		http.Error(writer, "Deck not found", http.StatusNotFound)
+		return
+	}
+
+	displayOptions := func() {
+		tmpl, _ := template.ParseFiles("./templates/deck_options.html", "./templates/navbar.html")
+		data := struct {
+			Title           string
+			Deck            Deck
+			Schedulers      []string
+			FuzzesIntervals bool
+		}{
+			Title:           "Options for " + deck.Name,
+			Deck:            deck,
+			Schedulers:      schedulerNames(),
+			FuzzesIntervals: fuzzesIntervals(deck),
+		}
+		tmpl.Execute(writer, data)
+	}
+
+	processForm := func() {
+		err := request.ParseForm()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		scheduler := request.FormValue("scheduler")
+		if _, ok := schedulers[scheduler]; !ok {
+			http.Error(writer, "Unknown scheduler", http.StatusBadRequest)
+			return
+		}
+		boxes, err := strconv.ParseUint(request.FormValue("leitner-boxes"), 10, 64)
+		if err != nil || boxes < minimumLeitnerBoxes || boxes > maximumLeitnerBoxes {
+			http.Error(writer, "Leitner boxes must be a number from 5 to 7", http.StatusBadRequest)
+			return
+		}
+
+		learningSteps := request.FormValue("learning-steps")
+		relearningSteps := request.FormValue("relearning-steps")
+		for _, steps := range []string{learningSteps, relearningSteps} {
+			_, err = parseSteps(steps)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		graduatingInterval, err := strconv.ParseUint(request.FormValue("graduating-interval"), 10, 64)
+		if err != nil || graduatingInterval < 1 {
+			http.Error(writer, "Graduating interval must be at least one day", http.StatusBadRequest)
+			return
+		}
+		easyInterval, err := strconv.ParseUint(request.FormValue("easy-interval"), 10, 64)
+		if err != nil || easyInterval < 1 {
+			http.Error(writer, "Easy interval must be at least one day", http.StatusBadRequest)
+			return
+		}
+		lapseIntervalPercent, err := strconv.ParseUint(request.FormValue("lapse-interval-percent"), 10, 64)
+		if err != nil || lapseIntervalPercent > 100 {
+			http.Error(writer, "New interval after a lapse must be a percentage from 0 to 100", http.StatusBadRequest)
+			return
+		}
+		leechThreshold, err := strconv.ParseUint(request.FormValue("leech-threshold"), 10, 64)
+		if err != nil {
+			http.Error(writer, "Leech threshold must be a number", http.StatusBadRequest)
+			return
+		}
+		// decks that aren't fuzzed don't show the fuzz options
+		fuzzPercent, loadBalance := uint64(deck.FuzzPercent), deck.LoadBalance
+		if request.Form.Has("fuzz-percent") {
+			fuzzPercent, err = strconv.ParseUint(request.FormValue("fuzz-percent"), 10, 64)
+			if err != nil || fuzzPercent > 100 {
+				http.Error(writer, "Fuzz must be a percentage from 0 to 100", http.StatusBadRequest)
+				return
+			}
+			loadBalance = request.FormValue("load-balance") == "on"
+		}
+		typoTolerance, err := strconv.ParseUint(request.FormValue("typo-tolerance"), 10, 64)
+		if err != nil {
+			http.Error(writer, "Typo tolerance must be a number", http.StatusBadRequest)
+			return
+		}
+		nearMissPolicy := request.FormValue("near-miss-policy")
+		if !slices.Contains(nearMissPolicies, nearMissPolicy) {
+			http.Error(writer, "Unknown near miss policy", http.StatusBadRequest)
+			return
+		}
+		diacriticMode := request.FormValue("diacritic-mode")
+		if !slices.Contains(diacriticModes, diacriticMode) {
+			http.Error(writer, "Unknown accent mode", http.StatusBadRequest)
+			return
+		}
+		leechAction := request.FormValue("leech-action")
+		if leechAction != "tag" && leechAction != "suspend" {
+			http.Error(writer, "Unknown leech action", http.StatusBadRequest)
+			return
+		}
+
+		deck.Scheduler = scheduler
+		deck.LeitnerBoxes = uint(boxes)
+		deck.LearningSteps = strings.Join(strings.Fields(learningSteps), " ")
+		deck.RelearningSteps = strings.Join(strings.Fields(relearningSteps), " ")
+		deck.GraduatingInterval = uint(graduatingInterval)
+		deck.EasyInterval = uint(easyInterval)
+		deck.LapseIntervalPercent = uint(lapseIntervalPercent)
+		deck.LeechThreshold = uint(leechThreshold)
+		deck.LeechAction = leechAction
+		deck.FuzzPercent = uint(fuzzPercent)
+		deck.LoadBalance = loadBalance
+		deck.CreateReverse = request.FormValue("create-reverse") == "on"
+		deck.TypoTolerance = uint(typoTolerance)
+		deck.NearMissPolicy = nearMissPolicy
+		deck.DiacriticMode = diacriticMode
+		err = g.updateDeckOptions(deck)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		fmt.Fprintf(writer, "<div id='result'>Options for '%s' saved.</div>", template.HTMLEscapeString(deck.Name))
+	}
+
+	switch request.Method {
+	case "GET":
+		displayOptions()
+	case "POST":
+		processForm()
+	default:
+		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
+	}
+}
+
+func (g *GormDB) LearningMultipleChoiceHandler(writer http.ResponseWriter, request *http.Request) {
+
+	IDString := strings.TrimPrefix(request.URL.Path, "/learning-multiple-choice/")
+	id, _ := strconv.Atoi(IDString)
+	deck, _ := g.getDeckByID(uint(id))
+	tags := request.URL.Query()["tag"]
+	query := tagQuery(tags)
+
+	displayLearning := func() {
+		mostDueCard, _ := g.getMostDueLearningCardByDeckID(deck.ID, tags)
+		var cardAvailable bool
+
+		randomCards, _ := g.getRandomCardsByDeckID(deck.ID, mostDueCard.ID)
+		randomCards = append(randomCards, mostDueCard)
+		rand.Shuffle(len(randomCards), func(i, j int) {
+			randomCards[i], randomCards[j] = randomCards[j], randomCards[i]
+		})
+
+		if len(randomCards) > 3 && mostDueCard.ID != 0 {
+			cardAvailable = true
+		} else {
+			cardAvailable = false
+		}
+		tmpl, _ := template.ParseFiles("./templates/htmx/learning-multiple-choice.html", "./templates/navbar.html")
+		data := struct {
+			Title         string
+			Deck          Deck
+			RandomCards   []Card
+			MostDueCard   Card
+			CardAvailable bool
+			Query         string
+		}{
+			Title:         "Deck: " + deck.Name,
+			Deck:          deck,
+			RandomCards:   randomCards,
+			MostDueCard:   mostDueCard,
+			CardAvailable: cardAvailable,
+			Query:         query,
+		}
+
+		tmpl.Execute(writer, data)
+
+	}
+
+	processAnswer := func() {
+
+		request.ParseForm()
+
+		userAnswer := request.FormValue("answer")
+		cardID, _ := strconv.ParseInt(request.FormValue("card-id"), 10, 64)
+
+		card, _ := g.getCardByID(uint(cardID))
+
+		correct := IsAnswerCorrectInLowerCase(userAnswer, card.Answer)
+
+		// a grade comes from the grading buttons shown after a correct answer
+		if request.Form.Has("grade") {
+			current, _ := g.getMostDueLearningCardByDeckID(deck.ID, tags)
+			grade, err := postedGrade(request.FormValue("grade"), card, current, correct)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			g.updateLearningCardByID(uint(card.ID), grade)
+			displayLearning()
+			return
+		}
+		if correct {
+			displayGrading(writer, card, userAnswer, "/learning-multiple-choice/"+IDString+query, "")
+			return
+		}
+
+		g.updateLearningCardByID(uint(card.ID), GradeAgain)
+
+		data := struct {
+			Question      string
+			UserAnswer    string
+			CorrectAnswer string
+			Answers       []string
+			Diff          []DiffPart
+			CardID        uint
+			Route         string
+		}{
+			Question:      card.Question,
+			UserAnswer:    userAnswer,
+			CorrectAnswer: card.Answer,
+			Answers:       card.Answers(),
+			Route:         "/learning-multiple-choice/" + IDString + query,
+		}
+		tmpl, _ := template.ParseFiles("./templates/htmx/wrong-answer.html")
+
+		tmpl.Execute(writer, data)
+	}
+
+	switch request.Method {
+	case "GET":
+		displayLearning()
+	case "POST":
+		processAnswer()
+	}
+}
+
+func (g *GormDB) ReviewMultipleChoiceHandler(writer http.ResponseWriter, request *http.Request) {
+
+	IDString := strings.TrimPrefix(request.URL.Path, "/review-multiple-choice/")
+	id, _ := strconv.Atoi(IDString)
+	deck, _ := g.getDeckByID(uint(id))
+	tags := request.URL.Query()["tag"]
+	query := tagQuery(tags)
+
+	displayReview := func() {
+		mostDueCard, _ := g.getMostDueReviewCardByDeckID(deck.ID, tags)
+		var cardAvailable bool
+
+		randomCards, _ := g.getRandomCardsByDeckID(deck.ID, mostDueCard.ID)
+		randomCards = append(randomCards, mostDueCard)
+		rand.Shuffle(len(randomCards), func(i, j int) {
+			randomCards[i], randomCards[j] = randomCards[j], randomCards[i]
+		})
+
+		if len(randomCards) > 3 && mostDueCard.ID != 0 {
+			cardAvailable = true
+		} else {
+			cardAvailable = false
+		}
+		tmpl, _ := template.ParseFiles("./templates/htmx/review-multiple-choice.html", "./templates/navbar.html")
+		data := struct {
+			Title         string
+			Deck          Deck
+			RandomCards   []Card
+			MostDueCard   Card
+			CardAvailable bool
+			Query         string
+		}{
+			Title:         "Deck: " + deck.Name,
+			Deck:          deck,
+			RandomCards:   randomCards,
+			MostDueCard:   mostDueCard,
+			CardAvailable: cardAvailable,
+			Query:         query,
+		}
+
+		tmpl.Execute(writer, data)
+
+	}
+
+	processAnswer := func() {
+
+		request.ParseForm()
+
+		userAnswer := request.FormValue("answer")
+		cardID, _ := strconv.ParseInt(request.FormValue("card-id"), 10, 64)
+
+		card, _ := g.getCardByID(uint(cardID))
+
+		correct := IsAnswerCorrectInLowerCase(userAnswer, card.Answer)
+
+		// a grade comes from the grading buttons shown after a correct answer
+		if request.Form.Has("grade") {
+			current, _ := g.getMostDueReviewCardByDeckID(deck.ID, tags)
+			grade, err := postedGrade(request.FormValue("grade"), card, current, correct)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			g.updateReviewCardByID(uint(card.ID), grade)
+			displayReview()
+			return
+		}
+		if correct {
+			displayGrading(writer, card, userAnswer, "/review-multiple-choice/"+IDString+query, "")
+			return
+		}
+
+		g.updateReviewCardByID(uint(card.ID), GradeAgain)
+
+		data := struct {
+			Question      string
+			UserAnswer    string
+			CorrectAnswer string
+			Answers       []string
+			Diff          []DiffPart
+			CardID        uint
+			Route         string
+		}{
+			Question:      card.Question,
+			UserAnswer:    userAnswer,
+			CorrectAnswer: card.Answer,
+			Answers:       card.Answers(),
+			Route:         "/review-multiple-choice/" + IDString + query,
+		}
+		tmpl, _ := template.ParseFiles("./templates/htmx/wrong-answer.html")
+
+		tmpl.Execute(writer, data)
+	}
+
+	switch request.Method {
+	case "GET":
+		displayReview()
+	case "POST":
+		processAnswer()
+	}
+}
+
+func (g *GormDB) LearningTypingHandler(writer http.ResponseWriter, request *http.Request) {
+	//create string without /learning/ from the URL path
+	IDString := strings.TrimPrefix(request.URL.Path, "/learning-typing/")
+	id, _ := strconv.Atoi(IDString)
+	deck, _ := g.getDeckByID(uint(id))
+	tags := request.URL.Query()["tag"]
+	query := tagQuery(tags)
+	mostDueCard, err := g.getMostDueLearningCardByDeckID(deck.ID, tags)
+
+	cardAvailable := err == nil
+
+	//GET
+	displayCards := func() {
+		tmpl, _ := template.ParseFiles("./templates/htmx/learning-typing.html", "./templates/navbar.html")
+		data := struct {
+			Title         string
+			Deck          Deck
+			Card          Card
+			CardAvailable bool
+			Query         string
+			Message       string
+			Answer        string
 		}{
-			Title:   "Deck Creation",
-			Heading: "Create a deck",
-			Message: "All you need to create a deck is a deck name. Duplicate deck names are allowed.",
+			Title:         "Learning session for " + deck.Name,
+			Deck:          deck,
+			Card:          mostDueCard,
+			CardAvailable: cardAvailable,
+			Query:         query,
 		}
 		tmpl.Execute(writer, data)
 	}
-	processForm := func() {
-		err := request.ParseForm()
-		if err != nil {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
+
+	//POST
+	processAnswer := func() {
+		request.ParseForm()
+
+		userAnswer := request.FormValue("answer")
+		cardID, _ := strconv.ParseInt(request.FormValue("card-id"), 10, 64)
+
+		card, _ := g.getCardByID(uint(cardID))
+		cardDeck, _ := g.getDeckByID(card.DeckID)
+		verdict, matched := checkAnswers(answerCheckerFor(cardDeck), userAnswer, card.Answers())
+		correct := verdict == VerdictCorrect || verdict == VerdictAccents
+
+		// a grade comes from the grading buttons shown after a correct answer
+		if request.Form.Has("grade") {
+			grade, err := postedGrade(request.FormValue("grade"), card, mostDueCard, correct)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			g.updateLearningCardByID(uint(card.ID), grade)
+
+			mostDueCard, err := g.getMostDueLearningCardByDeckID(deck.ID, tags)
+			if err != nil {
+				data := struct {
+					Message string
+				}{
+					Message: "No learning cards left for this deck. Create some new cards ",
+				}
+				tmpl, _ := template.ParseFiles("./templates/htmx/nocards.html")
+
+				tmpl.Execute(writer, data)
+				return
+			}
+
+			data := struct {
+				Title         string
+				Deck          Deck
+				Card          Card
+				CardAvailable bool
+				Query         string
+				Message       string
+				Answer        string
+			}{
+				Title:         "Learning session for " + deck.Name,
+				Deck:          deck,
+				Card:          mostDueCard,
+				CardAvailable: true,
+				Query:         query,
+			}
+			tmpl, _ := template.ParseFiles("./templates/htmx/learning-typing.html")
+
+			tmpl.Execute(writer, data)
 			return
 		}
-		deckName := request.FormValue("deckname")
-		g.createDeck(deckName)
 
-		fmt.Fprintf(writer, "<div id='result'>Deck '%s' created successfully!</div>", deckName)
+		if verdict == VerdictNearMiss {
+			grade, counts := nearMissGrade(cardDeck)
+			if counts {
+				g.updateLearningCardByID(uint(card.ID), grade)
+				displayNearMiss(writer, card, userAnswer, matched, grade, "/learning-typing/"+IDString+query)
+				return
+			}
+			data := struct {
+				Title         string
+				Deck          Deck
+				Card          Card
+				CardAvailable bool
+				Query         string
+				Message       string
+				Answer        string
+			}{
+				Title:         "Learning session for " + deck.Name,
+				Deck:          deck,
+				Card:          card,
+				CardAvailable: true,
+				Query:         query,
+				Message:       nearMissMessage,
+				Answer:        userAnswer,
+			}
+			tmpl, _ := template.ParseFiles("./templates/htmx/learning-typing.html")
+			tmpl.Execute(writer, data)
+			return
+		}
+
+		if correct {
+			var message string
+			if verdict == VerdictAccents {
+				message = accentsMessage(matched)
+			}
+			displayGrading(writer, card, userAnswer, "/learning-typing/"+IDString+query, message)
+			return
+		}
+
+		g.updateLearningCardByID(uint(card.ID), GradeAgain)
+
+		data := struct {
+			Question      string
+			UserAnswer    string
+			CorrectAnswer string
+			Answers       []string
+			Diff          []DiffPart
+			CardID        uint
+			Route         string
+		}{
+			Question:      card.Question,
+			UserAnswer:    userAnswer,
+			CorrectAnswer: card.Answer,
+			Answers:       card.Answers(),
+			Diff:          diffAnswer(userAnswer, closestAnswer(userAnswer, card.Answers())),
+			CardID:        card.ID,
+			Route:         "/learning-typing/" + IDString + query,
+		}
+		tmpl, _ := template.ParseFiles("./templates/htmx/wrong-answer.html")
 
+		tmpl.Execute(writer, data)
 	}
 
 	switch request.Method {
 	case "GET":
-		displayForm()
+		displayCards()
 	case "POST":
-		processForm()
+		processAnswer()
 	default:
 		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
 	}
 
 }
 
-func IsAnswerCorrectInLowerCase(userAnswer string, databaseAnswer string) bool {
-	return strings.EqualFold(strings.TrimSpace(userAnswer), (strings.TrimSpace(databaseAnswer)))
+// errUnexpectedGrade is returned for a grade that doesn't come from the
+// grading buttons of the card a session is on.
+var errUnexpectedGrade = errors.New("only the card that was just answered correctly can be graded")
+
+// postedGrade reads a grade sent by the grading buttons. They send it along
+// with the answer, so the grade is only taken if that answer is correct and
+// card is the current card of the session.
+func postedGrade(value string, card Card, current Card, correct bool) (Grade, error) {
+	if !correct || card.ID != current.ID {
+		return GradeAgain, errUnexpectedGrade
+	}
+	return parseGrade(value)
 }
-func getMostDueCard(cards []Card) (Card, error) {
 
-	var mostDueCard Card
-	if len(cards) > 0 {
-		mostDueCard = cards[0]
+// displayGrading asks the user how well they knew the card they answered
+// correctly.
+func displayGrading(writer http.ResponseWriter, card Card, userAnswer string, route string, message string) {
+	data := struct {
+		Card    Card
+		Answer  string
+		Grades  []Grade
+		Route   string
+		Message string
+	}{
+		Card:    card,
+		Answer:  userAnswer,
+		Grades:  grades,
+		Route:   route,
+		Message: message,
 	}
+	tmpl, _ := template.ParseFiles("./templates/htmx/grade.html")
 
-	if len(cards) > 1 {
-		mostDueCardTime, err := time.Parse(time.RFC3339Nano, cards[0].ReviewDueDate)
-		if err != nil {
-			fmt.Print(err.Error())
-			return Card{}, err
+	tmpl.Execute(writer, data)
+}
+
+// nearMissMessage tells the user that a typed answer was close.
+const nearMissMessage = "Almost — check your spelling"
+
+// displayNearMiss shows the answer that was nearly typed after a near miss
+// that was graded as the deck's near-miss policy says.
+func displayNearMiss(writer http.ResponseWriter, card Card, userAnswer string, answer string, grade Grade, route string) {
+	data := struct {
+		Message       string
+		Question      string
+		UserAnswer    string
+		CorrectAnswer string
+		Grade         Grade
+		Route         string
+	}{
+		Message:       nearMissMessage,
+		Question:      card.Question,
+		UserAnswer:    userAnswer,
+		CorrectAnswer: answer,
+		Grade:         grade,
+		Route:         route,
+	}
+	tmpl, _ := template.ParseFiles("./templates/htmx/near-miss.html")
+
+	tmpl.Execute(writer, data)
+}
+
+func (g *GormDB) ReviewTypingHandler(writer http.ResponseWriter, request *http.Request) {
+	//create string without /learning/ from the URL path
+	IDString := strings.TrimPrefix(request.URL.Path, "/review-typing/")
+	id, _ := strconv.Atoi(IDString)
+	deck, _ := g.getDeckByID(uint(id))
+	tags := request.URL.Query()["tag"]
+	query := tagQuery(tags)
+	mostDueCard, err := g.getMostDueReviewCardByDeckID(deck.ID, tags)
+
+	cardAvailable := err == nil
+	//GET
+	displayCards := func() {
+		tmpl, _ := template.ParseFiles("./templates/htmx/review-typing.html")
+		data := struct {
+			Title         string
+			Deck          Deck
+			Card          Card
+			CardAvailable bool
+			Query         string
+			Message       string
+			Answer        string
+		}{
+			Title:         "Review session for " + deck.Name,
+			Deck:          deck,
+			Card:          mostDueCard,
+			CardAvailable: cardAvailable,
+			Query:         query,
 		}
+		tmpl.Execute(writer, data)
+	}
+
+	//POST
+	processAnswer := func() {
+		request.ParseForm()
+
+		userAnswer := request.FormValue("answer")
+		cardID, _ := strconv.ParseInt(request.FormValue("card-id"), 10, 64)
+
+		card, _ := g.getCardByID(uint(cardID))
+		cardDeck, _ := g.getDeckByID(card.DeckID)
+		verdict, matched := checkAnswers(answerCheckerFor(cardDeck), userAnswer, card.Answers())
+		correct := verdict == VerdictCorrect || verdict == VerdictAccents
 
-		for i := 0; i < len(cards); i++ {
-			currentCardDueDate, err := time.Parse(time.RFC3339Nano, cards[i].ReviewDueDate)
+		// a grade comes from the grading buttons shown after a correct answer
+		if request.Form.Has("grade") {
+			grade, err := postedGrade(request.FormValue("grade"), card, mostDueCard, correct)
 			if err != nil {
-				fmt.Print(err.Error())
-				return Card{}, err
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			g.updateReviewCardByID(uint(card.ID), grade)
+
+			mostDueCard, err := g.getMostDueReviewCardByDeckID(deck.ID, tags)
+			if err != nil {
+				data := struct {
+					Message string
+				}{
+					Message: "No review cards left for this deck. Do some learning cards.",
+				}
+				tmpl, _ := template.ParseFiles("./templates/htmx/nocards.html")
+
+				tmpl.Execute(writer, data)
+				return
+			}
+
+			data := struct {
+				Title         string
+				Deck          Deck
+				Card          Card
+				CardAvailable bool
+				Query         string
+				Message       string
+				Answer        string
+			}{
+				Title:         "Review session for " + deck.Name,
+				Deck:          deck,
+				Card:          mostDueCard,
+				CardAvailable: true,
+				Query:         query,
+			}
+			tmpl, _ := template.ParseFiles("./templates/htmx/review-typing.html")
+
+			tmpl.Execute(writer, data)
+			return
+		}
+
+		if verdict == VerdictNearMiss {
+			grade, counts := nearMissGrade(cardDeck)
+			if counts {
+				g.updateReviewCardByID(uint(card.ID), grade)
+				displayNearMiss(writer, card, userAnswer, matched, grade, "/review-typing/"+IDString+query)
+				return
+			}
+			data := struct {
+				Title         string
+				Deck          Deck
+				Card          Card
+				CardAvailable bool
+				Query         string
+				Message       string
+				Answer        string
+			}{
+				Title:         "Review session for " + deck.Name,
+				Deck:          deck,
+				Card:          card,
+				CardAvailable: true,
+				Query:         query,
+				Message:       nearMissMessage,
+				Answer:        userAnswer,
 			}
-			if currentCardDueDate.Before(mostDueCardTime) {
-				mostDueCardTime = currentCardDueDate
-				mostDueCard = cards[i]
+			tmpl, _ := template.ParseFiles("./templates/htmx/review-typing.html")
+			tmpl.Execute(writer, data)
+			return
+		}
+
+		if correct {
+			var message string
+			if verdict == VerdictAccents {
+				message = accentsMessage(matched)
 			}
+			displayGrading(writer, card, userAnswer, "/review-typing/"+IDString+query, message)
+			return
+		}
 
+		g.updateReviewCardByID(uint(card.ID), GradeAgain)
+
+		data := struct {
+			Question      string
+			UserAnswer    string
+			CorrectAnswer string
+			Answers       []string
+			Diff          []DiffPart
+			CardID        uint
+			Route         string
+		}{
+			Question:      card.Question,
+			UserAnswer:    userAnswer,
+			CorrectAnswer: card.Answer,
+			Answers:       card.Answers(),
+			Diff:          diffAnswer(userAnswer, closestAnswer(userAnswer, card.Answers())),
+			CardID:        card.ID,
+			Route:         "/review-typing/" + IDString + query,
 		}
-		return mostDueCard, err
-	} else if len(cards) == 1 {
-		return mostDueCard, nil
-	} else {
-		return Card{}, fmt.Errorf("no cards")
+		tmpl, _ := template.ParseFiles("./templates/htmx/wrong-answer.html")
+
+		tmpl.Execute(writer, data)
+	}
+
+	switch request.Method {
+	case "GET":
+		displayCards()
+	case "POST":
+		processAnswer()
+	default:
+		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
 	}
 
 }
 
-func (g *GormDB) DeckHandler(writer http.ResponseWriter, request *http.Request) {
-	IDString := strings.TrimPrefix(request.URL.Path, "/deck/")
+func (g *GormDB) LearningHandler(writer http.ResponseWriter, request *http.Request) {
+	IDString := strings.TrimPrefix(request.URL.Path, "/learning/")
 	id, _ := strconv.Atoi(IDString)
 	deck, _ := g.getDeckByID(uint(id))
-	cards, _ := g.getAllCardsByDeckID(uint(id))
+	tags := request.URL.Query()["tag"]
+	query := tagQuery(tags)
+	_, err := g.getMostDueLearningCardByDeckID(deck.ID, tags)
 
-	displayCards := func() {
-		tmpl, _ := template.ParseFiles("./templates/deck.html", "./templates/navbar.html")
+	cardAvailable := err == nil
+
+	displayDeckLearning := func() {
+		tmpl, _ := template.ParseFiles("./templates/learn.html", "./templates/navbar.html")
 		data := struct {
-			Title string
-			Deck  Deck
-			Cards []Card
+			Title         string
+			Deck          Deck
+			CardAvailable bool
+			Query         string
 		}{
-			Title: "Deck " + deck.Name,
-			Deck:  deck,
-			Cards: cards,
+			Title:         "Learning session for " + deck.Name,
+			Deck:          deck,
+			CardAvailable: cardAvailable,
+			Query:         query,
 		}
 		tmpl.Execute(writer, data)
 	}
 
 	switch request.Method {
 	case "GET":
-		displayCards()
+		displayDeckLearning()
 	default:
 		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
 	}
 
 }
-
-func (g *GormDB) LearningMultipleChoiceHandler(writer http.ResponseWriter, request *http.Request) {
-
-	IDString := strings.TrimPrefix(request.URL.Path, "/learning-multiple-choice/")
+func (g *GormDB) ReviewHandler(writer http.ResponseWriter, request *http.Request) {
+	IDString := strings.TrimPrefix(request.URL.Path, "/review/")
 	id, _ := strconv.Atoi(IDString)
 	deck, _ := g.getDeckByID(uint(id))
+	tags := request.URL.Query()["tag"]
+	query := tagQuery(tags)
+	_, err := g.getMostDueReviewCardByDeckID(deck.ID, tags)
 
-	displayLearning := func() {
-		cards, _ := g.getLearningCardsByDeckID(deck.ID)
-		mostDueCard, _ := getMostDueCard(cards)
-		var cardAvailable bool
-
-		randomCards, _ := g.getRandomCardsByDeckID(deck.ID, mostDueCard.ID)
-		randomCards = append(randomCards, mostDueCard)
-		rand.Shuffle(len(randomCards), func(i, j int) {
-			randomCards[i], randomCards[j] = randomCards[j], randomCards[i]
-		})
+	cardAvailable := err == nil
 
-		if len(randomCards) > 3 {
-			cardAvailable = true
-		} else {
-			cardAvailable = false
-		}
-		tmpl, _ := template.ParseFiles("./templates/htmx/learning-multiple-choice.html", "./templates/navbar.html")
+	displayDeckLearning := func() {
+		tmpl, _ := template.ParseFiles("./templates/review.html", "./templates/navbar.html")
 		data := struct {
 			Title         string
 			Deck          Deck
-			RandomCards   []Card
-			MostDueCard   Card
 			CardAvailable bool
+			Query         string
 		}{
-			Title:         "Deck: " + deck.Name,
+			Title:         "Review session for " + deck.Name,
 			Deck:          deck,
-			RandomCards:   randomCards,
-			MostDueCard:   mostDueCard,
 			CardAvailable: cardAvailable,
+			Query:         query,
 		}
+		tmpl.Execute(writer, data)
+	}
+
+	switch request.Method {
+	case "GET":
+		displayDeckLearning()
+	default:
+		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
+	}
+
+}
 
+func (g *GormDB) CreateCardHandler(writer http.ResponseWriter, request *http.Request) {
+	displayForm := func() {
+		tmpl, _ := template.ParseFiles("./templates/create_card.html", "./templates/navbar.html")
+		decks, _ := g.selectAllDecks()
+		data := struct {
+			Title   string
+			Heading string
+			Message string
+			Decks   []Deck
+		}{
+			Title:   "Card creation",
+			Heading: "Create a card",
+			Message: "A card needs a question and an answer",
+			Decks:   decks,
+		}
 		tmpl.Execute(writer, data)
+	}
+	processForm := func() {
+		request.ParseForm()
+
+		deckID, _ := strconv.ParseInt(request.FormValue("deck-id"), 10, 64)
+		question := request.FormValue("question")
+		answer := joinAnswers(parseAnswers(request.Form["answer"]))
+
+		t := time.Now().UTC()
+
+		var card Card
+		card.DeckID = uint(deckID)
+		card.Question = question
+		card.Answer = answer
+		card.Notes = request.FormValue("notes")
+		card.Tags, _ = g.getOrCreateTags(parseTags(request.FormValue("tags")))
+		card.CardCreated = t
+		card.ReviewDueDate = t
+
+		deck, _ := g.getDeckByID(card.DeckID)
+		if request.FormValue("reverse") == "on" || deck.CreateReverse {
+			g.createCardPair(card)
+			fmt.Fprintf(writer, "<div id='result'>Card with question '%s' and answer '%s' and its reverse created successfully!</div>", question, answer)
+			return
+		}
+		g.createCard(card)
+
+		fmt.Fprintf(writer, "<div id='result'>Card with question '%s' and answer '%s' created successfully!</div>", question, answer)
 
 	}
 
-	processAnswer := func() {
-
-		request.ParseForm()
+	switch request.Method {
+	case "GET":
+		displayForm()
+	case "POST":
+		processForm()
+	default:
+		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
+	}
 
-		userAnswer := request.FormValue("answer")
-		cardID, _ := strconv.ParseInt(request.FormValue("card-id"), 10, 64)
+}
 
-		card, _ := g.getCardByID(uint(cardID))
+// EditCardHandler shows the editor of a card as a page of its own or, when the
+// deck page asks for it, as an inline form in place of the card's row.
+func (g *GormDB) EditCardHandler(writer http.ResponseWriter, request *http.Request) {
+	IDString := strings.TrimPrefix(request.URL.Path, "/edit-card/")
+	id, _ := strconv.Atoi(IDString)
+	card, err := g.getCardByID(uint(id))
+	if err != nil {
+		http.Error(writer, "Card not found", http.StatusNotFound)
+		return
+	}
 
-		if IsAnswerCorrectInLowerCase(userAnswer, card.Answer) {
-			g.updateLearningCardByID(uint(card.ID), true)
+	// htmx names the element it swaps, which is the card's row on the deck page
+	inline := request.Header.Get("HX-Target") == "card-"+IDString
 
-			cards, _ := g.getLearningCardsByDeckID(deck.ID)
-			mostDueCard, _ := getMostDueCard(cards)
+	displayEditor := func() {
+		decks, _ := g.selectAllDecks()
+		data := struct {
+			Title  string
+			Card   Card
+			Decks  []Deck
+			Inline bool
+		}{
+			Title:  "Edit card",
+			Card:   card,
+			Decks:  decks,
+			Inline: inline,
+		}
 
-			var cardAvailable bool
+		if inline {
+			tmpl, _ := template.ParseFiles("./templates/htmx/card-edit.html")
+			tmpl.Execute(writer, data)
+			return
+		}
+		tmpl, _ := template.ParseFiles("./templates/edit_card.html", "./templates/navbar.html", "./templates/htmx/card-edit.html")
+		tmpl.Execute(writer, data)
+	}
 
-			randomCards, _ := g.getRandomCardsByDeckID(deck.ID, mostDueCard.ID)
-			randomCards = append(randomCards, mostDueCard)
-			rand.Shuffle(len(randomCards), func(i, j int) {
-				randomCards[i], randomCards[j] = randomCards[j], randomCards[i]
-			})
+	processForm := func() {
+		err := request.ParseForm()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-			if len(randomCards) > 3 && mostDueCard.ID != 0 {
-				cardAvailable = true
-			} else {
-				cardAvailable = false
-			}
-			tmpl, _ := template.ParseFiles("./templates/htmx/learning-multiple-choice.html", "./templates/navbar.html")
-			data := struct {
-				Title         string
-				Deck          Deck
-				RandomCards   []Card
-				MostDueCard   Card
-				CardAvailable bool
-			}{
-				Title:         "Deck: " + deck.Name,
-				Deck:          deck,
-				RandomCards:   randomCards,
-				MostDueCard:   mostDueCard,
-				CardAvailable: cardAvailable,
-			}
+		deckID, err := strconv.Atoi(request.FormValue("deck-id"))
+		if err != nil {
+			http.Error(writer, "Invalid deck", http.StatusBadRequest)
+			return
+		}
+		_, err = g.getDeckByID(uint(deckID))
+		if err != nil {
+			http.Error(writer, "Deck not found", http.StatusBadRequest)
+			return
+		}
 
-			tmpl.Execute(writer, data)
+		question := strings.TrimSpace(request.FormValue("question"))
+		answer := joinAnswers(parseAnswers(request.Form["answer"]))
+		if question == "" || answer == "" {
+			http.Error(writer, "A card needs a question and an answer", http.StatusBadRequest)
+			return
+		}
 
-		} else {
-			g.updateLearningCardByID(uint(card.ID), false)
+		previousDeckID := card.DeckID
+		card.DeckID = uint(deckID)
+		card.Question = question
+		card.Answer = answer
+		card.Notes = request.FormValue("notes")
+		card.Tags, err = g.getOrCreateTags(parseTags(request.FormValue("tags")))
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if request.FormValue("reset-scheduling") == "on" {
+			card = resetScheduling(card, time.Now().UTC())
+		}
 
-			data := struct {
-				Question      string
-				UserAnswer    string
-				CorrectAnswer string
-				Route         string
-			}{
-				Question:      card.Question,
-				UserAnswer:    userAnswer,
-				CorrectAnswer: card.Answer,
-				Route:         "/learning-multiple-choice/" + IDString,
+		err = g.updateCard(card)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if request.FormValue("reverse") == "on" && card.SiblingID == 0 {
+			err = g.addReverseCard(card)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
 			}
-			tmpl, _ := template.ParseFiles("./templates/htmx/wrong-answer.html")
-
-			tmpl.Execute(writer, data)
+			card, _ = g.getCardByID(card.ID)
 		}
 
+		if !inline {
+			fmt.Fprintf(writer, "<div id='result'>Card with question '%s' saved.</div>", template.HTMLEscapeString(card.Question))
+			return
+		}
+		// a card moved to another deck leaves the table of this one
+		if card.DeckID != previousDeckID {
+			return
+		}
+		tmpl, _ := template.ParseFiles("./templates/htmx/card-row.html")
+		tmpl.Execute(writer, card)
 	}
 
 	switch request.Method {
 	case "GET":
-		displayLearning()
+		displayEditor()
 	case "POST":
-		processAnswer()
+		processForm()
+	default:
+		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
 	}
 }
 
-func (g *GormDB) ReviewMultipleChoiceHandler(writer http.ResponseWriter, request *http.Request) {
-
-	IDString := strings.TrimPrefix(request.URL.Path, "/review-multiple-choice/")
+// CardRowHandler returns the row of a card in the deck page, which replaces
+// the inline editor when editing is cancelled.
+func (g *GormDB) CardRowHandler(writer http.ResponseWriter, request *http.Request) {
+	IDString := strings.TrimPrefix(request.URL.Path, "/card-row/")
 	id, _ := strconv.Atoi(IDString)
-	deck, _ := g.getDeckByID(uint(id))
 
-	displayReview := func() {
-		cards, _ := g.getDueReviewCardsByDeckID(deck.ID)
-		mostDueCard, _ := getMostDueCard(cards)
-		var cardAvailable bool
+	displayRow := func() {
+		card, err := g.getCardByID(uint(id))
+		if err != nil {
+			http.Error(writer, "Card not found", http.StatusNotFound)
+			return
+		}
+		tmpl, _ := template.ParseFiles("./templates/htmx/card-row.html")
+		tmpl.Execute(writer, card)
+	}
 
-		randomCards, _ := g.getRandomCardsByDeckID(deck.ID, mostDueCard.ID)
-		randomCards = append(randomCards, mostDueCard)
-		rand.Shuffle(len(randomCards), func(i, j int) {
-			randomCards[i], randomCards[j] = randomCards[j], randomCards[i]
-		})
+	switch request.Method {
+	case "GET":
+		displayRow()
+	default:
+		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
+	}
+}
 
-		if len(randomCards) > 3 {
-			cardAvailable = true
-		} else {
-			cardAvailable = false
-		}
-		tmpl, _ := template.ParseFiles("./templates/htmx/review-multiple-choice.html", "./templates/navbar.html")
+func (g *GormDB) DecksHandler(writer http.ResponseWriter, request *http.Request) {
+	displayDecks := func() {
+		tmpl, _ := template.ParseFiles("./templates/decks.html", "./templates/navbar.html")
+		tree, _ := g.getDeckTree()
 		data := struct {
-			Title         string
-			Deck          Deck
-			RandomCards   []Card
-			MostDueCard   Card
-			CardAvailable bool
+			Title string
+			Tree  []DeckNode
 		}{
-			Title:         "Deck: " + deck.Name,
-			Deck:          deck,
-			RandomCards:   randomCards,
-			MostDueCard:   mostDueCard,
-			CardAvailable: cardAvailable,
+			Title: "List of Decks",
+			Tree:  tree,
 		}
-
 		tmpl.Execute(writer, data)
-
 	}
 
-	processAnswer := func() {
-
-		request.ParseForm()
-
-		userAnswer := request.FormValue("answer")
-		cardID, _ := strconv.ParseInt(request.FormValue("card-id"), 10, 64)
-
-		card, _ := g.getCardByID(uint(cardID))
-
-		if IsAnswerCorrectInLowerCase(userAnswer, card.Answer) {
-			g.updateReviewCardByID(uint(card.ID), true)
+	switch request.Method {
+	case "GET":
+		displayDecks()
+	default:
+		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
+	}
+}
 
-			cards, _ := g.getDueReviewCardsByDeckID(deck.ID)
-			mostDueCard, _ := getMostDueCard(cards)
+func (g *GormDB) ManageDeckHandler(writer http.ResponseWriter, request *http.Request) {
+	IDString := strings.TrimPrefix(request.URL.Path, "/manage-deck/")
+	id, _ := strconv.Atoi(IDString)
+	deck, err := g.getDeckByID(uint(id))
+	if err != nil {
+		http.Error(writer, "Deck not found", http.StatusNotFound)
+		return
+	}
 
-			var cardAvailable bool
+	displayManagement := func() {
+		tmpl, _ := template.ParseFiles("./templates/manage_deck.html", "./templates/navbar.html")
+		decks, _ := g.selectAllDecks()
 
-			randomCards, _ := g.getRandomCardsByDeckID(deck.ID, mostDueCard.ID)
-			randomCards = append(randomCards, mostDueCard)
-			rand.Shuffle(len(randomCards), func(i, j int) {
-				randomCards[i], randomCards[j] = randomCards[j], randomCards[i]
-			})
+		subtree := subtreeDeckIDs(decks, deck.ID)
 
-			if len(randomCards) > 3 && mostDueCard.ID != 0 {
-				cardAvailable = true
-			} else {
-				cardAvailable = false
-			}
-			tmpl, _ := template.ParseFiles("./templates/htmx/review-multiple-choice.html", "./templates/navbar.html")
-			data := struct {
-				Title         string
-				Deck          Deck
-				RandomCards   []Card
-				MostDueCard   Card
-				CardAvailable bool
-			}{
-				Title:         "Deck: " + deck.Name,
-				Deck:          deck,
-				RandomCards:   randomCards,
-				MostDueCard:   mostDueCard,
-				CardAvailable: cardAvailable,
+		var otherDecks, parents []Deck
+		for _, other := range decks {
+			if other.ID != deck.ID {
+				otherDecks = append(otherDecks, other)
 			}
-
-			tmpl.Execute(writer, data)
-
-		} else {
-			g.updateReviewCardByID(uint(card.ID), false)
-
-			data := struct {
-				Question      string
-				UserAnswer    string
-				CorrectAnswer string
-				Route         string
-			}{
-				Question:      card.Question,
-				UserAnswer:    userAnswer,
-				CorrectAnswer: card.Answer,
-				Route:         "/review-multiple-choice/" + IDString,
+			if !slices.Contains(subtree, other.ID) {
+				parents = append(parents, other)
 			}
-			tmpl, _ := template.ParseFiles("./templates/htmx/wrong-answer.html")
+		}
 
-			tmpl.Execute(writer, data)
+		data := struct {
+			Title       string
+			Deck        Deck
+			OtherDecks  []Deck
+			Parents     []Deck
+			Paths       map[uint]string
+			Resolutions []string
+		}{
+			Title:       "Manage " + deck.Name,
+			Deck:        deck,
+			OtherDecks:  otherDecks,
+			Parents:     parents,
+			Paths:       deckPaths(decks),
+			Resolutions: mergeResolutions,
 		}
+		tmpl.Execute(writer, data)
 	}
 
 	switch request.Method {
 	case "GET":
-		displayReview()
-	case "POST":
-		processAnswer()
+		displayManagement()
+	default:
+		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
 	}
 }
 
-func (g *GormDB) LearningTypingHandler(writer http.ResponseWriter, request *http.Request) {
-	//create string without /learning/ from the URL path
-	IDString := strings.TrimPrefix(request.URL.Path, "/learning-typing/")
+// DeckActionHandler renames, moves, duplicates, merges or deletes a deck.
+func (g *GormDB) DeckActionHandler(writer http.ResponseWriter, request *http.Request) {
+	action, IDString, _ := strings.Cut(strings.TrimPrefix(request.URL.Path, "/"), "/")
 	id, _ := strconv.Atoi(IDString)
-	deck, _ := g.getDeckByID(uint(id))
-	cards, _ := g.getLearningCardsByDeckID(deck.ID)
-	mostDueCard, _ := getMostDueCard(cards)
-
-	var cardAvailable bool
-
-	if len(cards) > 0 {
-		cardAvailable = true
-	} else {
-		cardAvailable = false
+	deck, err := g.getDeckByID(uint(id))
+	if err != nil {
+		http.Error(writer, "Deck not found", http.StatusNotFound)
+		return
 	}
 
-	//GET
-	displayCards := func() {
-		tmpl, _ := template.ParseFiles("./templates/htmx/learning-typing.html", "./templates/navbar.html")
-		data := struct {
-			Title         string
-			Deck          Deck
-			Cards         []Card
-			Card          Card
-			CardAvailable bool
-		}{
-			Title:         "Learning session for " + deck.Name,
-			Deck:          deck,
-			Cards:         cards,
-			Card:          mostDueCard,
-			CardAvailable: cardAvailable,
+	// otherDeck returns the deck named by a form field, which must not be the deck itself
+	otherDeck := func(field string) (Deck, error) {
+		otherID, err := strconv.Atoi(request.FormValue(field))
+		if err != nil || uint(otherID) == deck.ID {
+			return Deck{}, fmt.Errorf("choose another deck")
 		}
-		tmpl.Execute(writer, data)
+		return g.getDeckByID(uint(otherID))
 	}
 
-	//POST
-	processAnswer := func() {
-		request.ParseForm()
-
-		userAnswer := request.FormValue("answer")
-		cardID, _ := strconv.ParseInt(request.FormValue("card-id"), 10, 64)
+	processAction := func() {
+		err := request.ParseForm()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-		card, _ := g.getCardByID(uint(cardID))
+		switch action {
+		case "rename-deck":
+			name := strings.TrimSpace(request.FormValue("deckname"))
+			if name == "" {
+				http.Error(writer, "A deck needs a name", http.StatusBadRequest)
+				return
+			}
+			err = g.renameDeck(deck.ID, name)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprintf(writer, "<div id='result'>Deck '%s' renamed to '%s'.</div>", template.HTMLEscapeString(deck.Name), template.HTMLEscapeString(name))
 
-		if IsAnswerCorrectInLowerCase(userAnswer, card.Answer) {
-			g.updateLearningCardByID(uint(card.ID), true)
-			cards, _ := g.getLearningCardsByDeckID(deck.ID)
-			mostDueCard, _ := getMostDueCard(cards)
+		case "move-deck":
+			parentID, _ := strconv.Atoi(request.FormValue("parent-id"))
+			subtree, err := g.getSubtreeDeckIDs(deck.ID)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if slices.Contains(subtree, uint(parentID)) {
+				http.Error(writer, "A deck can't be moved below itself", http.StatusBadRequest)
+				return
+			}
+			err = g.setDeckParent(deck.ID, uint(parentID))
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprintf(writer, "<div id='result'>Deck '%s' moved.</div>", template.HTMLEscapeString(deck.Name))
 
-			if len(cards) > 0 {
+		case "duplicate-deck":
+			duplicate, err := g.duplicateDeck(deck.ID)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprintf(writer, "<div id='result'>Deck duplicated as <a href='/deck/%d'>%s</a>.</div>", duplicate.ID, template.HTMLEscapeString(duplicate.Name))
 
-				data := struct {
-					Title         string
-					Deck          Deck
-					Cards         []Card
-					Card          Card
-					CardAvailable bool
-				}{
-					Title:         "Learning session for " + deck.Name,
-					Deck:          deck,
-					Cards:         cards,
-					Card:          mostDueCard,
-					CardAvailable: cardAvailable,
+		case "merge-deck":
+			target, err := otherDeck("target-id")
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			resolution := request.FormValue("resolution")
+			if !slices.Contains(mergeResolutions, resolution) {
+				http.Error(writer, "Unknown way to resolve duplicates", http.StatusBadRequest)
+				return
+			}
+			err = g.mergeDecks(deck.ID, target.ID, resolution)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprintf(writer, "<div id='result'>Deck '%s' merged into <a href='/deck/%d'>%s</a>.</div>", template.HTMLEscapeString(deck.Name), target.ID, template.HTMLEscapeString(target.Name))
+
+		case "delete-deck":
+			var moveTo uint
+			if request.FormValue("move-to") != "0" {
+				target, err := otherDeck("move-to")
+				if err != nil {
+					http.Error(writer, err.Error(), http.StatusBadRequest)
+					return
 				}
+				moveTo = target.ID
+			}
+			err = g.deleteDeck(deck.ID, moveTo)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprintf(writer, "<div id='result'>Deck '%s' deleted. Back to <a href='/decks'>Decks</a>.</div>", template.HTMLEscapeString(deck.Name))
+		}
+	}
 
-				tmpl, _ := template.ParseFiles("./templates/htmx/learning-typing.html")
+	switch request.Method {
+	case "POST":
+		processAction()
+	default:
+		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
+	}
+}
 
-				tmpl.Execute(writer, data)
+// CardActionHandler suspends, unsuspends, buries or unburies a card. Requests
+// from a study session name the session route to continue with, requests from
+// the deck page get the updated card row back.
+func (g *GormDB) CardActionHandler(writer http.ResponseWriter, request *http.Request) {
+	action, IDString, _ := strings.Cut(strings.TrimPrefix(request.URL.Path, "/"), "/")
+	id, _ := strconv.Atoi(IDString)
 
-			} else {
-				data := struct {
-					Message string
-				}{
-					Message: "No learning cards left for this deck. Create some new cards ",
-				}
-				tmpl, _ := template.ParseFiles("./templates/htmx/nocards.html")
+	actions := map[string]func(id uint) error{
+		"suspend-card":   g.suspendCardByID,
+		"unsuspend-card": g.unsuspendCardByID,
+		"bury-card":      g.buryCardByID,
+		"unbury-card":    g.unburyCardByID,
+	}
 
-				tmpl.Execute(writer, data)
-			}
+	processAction := func() {
+		request.ParseForm()
 
-		} else {
-			g.updateLearningCardByID(uint(card.ID), false)
-			data := struct {
-				Question      string
-				UserAnswer    string
-				CorrectAnswer string
-				Route         string
-			}{
-				Question:      card.Question,
-				UserAnswer:    userAnswer,
-				CorrectAnswer: card.Answer,
-				Route:         "/learning-typing/" + IDString,
-			}
-			tmpl, _ := template.ParseFiles("./templates/htmx/wrong-answer.html")
+		err := actions[action](uint(id))
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-			tmpl.Execute(writer, data)
+		route := request.FormValue("route")
+		if isLocalRoute(route) {
+			http.Redirect(writer, request, route, http.StatusSeeOther)
+			return
 		}
 
+		card, err := g.getCardByID(uint(id))
+		if err != nil {
+			http.Error(writer, "Card not found", http.StatusNotFound)
+			return
+		}
+		tmpl, _ := template.ParseFiles("./templates/htmx/card-row.html")
+		tmpl.Execute(writer, card)
 	}
 
 	switch request.Method {
-	case "GET":
-		displayCards()
 	case "POST":
-		processAnswer()
+		processAction()
 	default:
 		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
 	}
-
 }
 
-func isCardsNotEmpty(cards []Card) bool {
-	if len(cards) > 0 {
-		return true
-	} else {
-		return false
+// parseCardIDs reads the card IDs of a bulk action from form values. A value
+// can hold several comma separated IDs. Duplicates and invalid IDs are dropped.
+func parseCardIDs(values []string) []uint {
+	var ids []uint
+	for _, value := range values {
+		for _, field := range strings.Split(value, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || id <= 0 || slices.Contains(ids, uint(id)) {
+				continue
+			}
+			ids = append(ids, uint(id))
+		}
 	}
+	return ids
 }
 
-func (g *GormDB) ReviewTypingHandler(writer http.ResponseWriter, request *http.Request) {
-	//create string without /learning/ from the URL path
-	IDString := strings.TrimPrefix(request.URL.Path, "/review-typing/")
-	id, _ := strconv.Atoi(IDString)
-	deck, _ := g.getDeckByID(uint(id))
-	cards, _ := g.getDueReviewCardsByDeckID(deck.ID)
-	mostDueCard, _ := getMostDueCard(cards)
+// filterCardsByDecks keeps the IDs of the cards that belong to one of the
+// decks, deleted cards included.
+func (g *GormDB) filterCardsByDecks(ids []uint, deckIDs []uint) ([]uint, error) {
+	var kept []uint
+	err := g.db.Unscoped().Model(&Card{}).Where("id IN ? AND deck_id IN ?", ids, deckIDs).Order("id").Pluck("id", &kept).Error
+	return kept, err
+}
 
-	cardAvailable := isCardsNotEmpty(cards)
-	//GET
-	displayCards := func() {
-		tmpl, _ := template.ParseFiles("./templates/htmx/review-typing.html")
-		data := struct {
-			Title         string
-			Deck          Deck
-			Cards         []Card
-			Card          Card
-			CardAvailable bool
-		}{
-			Title:         "Review session for " + deck.Name,
-			Deck:          deck,
-			Cards:         cards,
-			Card:          mostDueCard,
-			CardAvailable: cardAvailable,
-		}
-		tmpl.Execute(writer, data)
-	}
+// BulkCardsHandler applies a bulk action to the cards selected on a deck page
+// and renders the deck's card browser again. Deleted cards can be restored
+// from the toast.
+func (g *GormDB) BulkCardsHandler(writer http.ResponseWriter, request *http.Request) {
+	IDString := strings.TrimPrefix(request.URL.Path, "/bulk-cards/")
+	id, _ := strconv.Atoi(IDString)
+	options := parseCardListOptions(request.URL.Query())
 
-	//POST
-	processAnswer := func() {
+	processAction := func() {
 		request.ParseForm()
 
-		userAnswer := request.FormValue("answer")
-		cardID, _ := strconv.ParseInt(request.FormValue("card-id"), 10, 64)
-
-		card, _ := g.getCardByID(uint(cardID))
-
-		if IsAnswerCorrectInLowerCase(userAnswer, card.Answer) {
-			g.updateReviewCardByID(uint(card.ID), true)
-
-			cards, _ := g.getDueReviewCardsByDeckID(deck.ID)
-			mostDueCard, _ := getMostDueCard(cards)
-
-			cardAvailable := isCardsNotEmpty(cards)
+		deck, err := g.getDeckByID(uint(id))
+		if err != nil {
+			http.Error(writer, "Deck not found", http.StatusNotFound)
+			return
+		}
 
-			if cardAvailable {
+		// only the cards of this deck and its subdecks can be changed from its page
+		deckIDs, err := g.getSubtreeDeckIDs(deck.ID)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ids, err := g.filterCardsByDecks(parseCardIDs(request.Form["card-id"]), deckIDs)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		action := BulkAction{Name: request.FormValue("action")}
+		var message string
+		switch action.Name {
+		case "move":
+			target, err := strconv.Atoi(request.FormValue("deck-id"))
+			if err == nil {
+				_, err = g.getDeckByID(uint(target))
+			}
+			if err != nil {
+				message = "Choose the deck to move the cards to"
+			}
+			action.DeckID = uint(target)
+		case "add-tag", "remove-tag":
+			names := parseTags(request.FormValue("tag"))
+			if len(names) != 1 {
+				message = "Enter one tag"
+			} else {
+				action.Tag = names[0]
+			}
+		case "reschedule":
+			action.Due, err = time.Parse("2006-01-02", request.FormValue("due"))
+			if err != nil {
+				message = "Choose the date to reschedule the cards to"
+			}
+		}
+		if _, ok := bulkActionResults[action.Name]; !ok {
+			message = "Choose an action"
+		}
+		if len(ids) == 0 {
+			message = "Select at least one card"
+		}
 
-				data := struct {
-					Title         string
-					Deck          Deck
-					Cards         []Card
-					Card          Card
-					CardAvailable bool
-				}{
-					Title:         "Review session for " + deck.Name,
-					Deck:          deck,
-					Cards:         cards,
-					Card:          mostDueCard,
-					CardAvailable: cardAvailable,
+		var deleted []string
+		if message == "" {
+			err = g.bulkUpdateCards(ids, action)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			message = fmt.Sprintf("%s %d cards", bulkActionResults[action.Name], len(ids))
+			if action.Name == "delete" {
+				for _, id := range ids {
+					deleted = append(deleted, strconv.Itoa(int(id)))
 				}
+			}
+		}
 
-				tmpl, _ := template.ParseFiles("./templates/htmx/review-typing.html")
+		if request.Header.Get("HX-Request") != "true" {
+			http.Redirect(writer, request, "/deck/"+IDString+options.Query(), http.StatusSeeOther)
+			return
+		}
 
-				tmpl.Execute(writer, data)
+		page := g.getDeckPage(deck, options)
+		page.Message = message
+		data := struct {
+			DeckPage
+			Deleted string
+		}{
+			DeckPage: page,
+			Deleted:  strings.Join(deleted, ","),
+		}
+		tmpl, _ := template.ParseFiles("./templates/htmx/bulk-cards.html", "./templates/deck_cards.html", "./templates/htmx/card-row.html")
+		tmpl.Execute(writer, data)
+	}
 
-			} else {
-				data := struct {
-					Message string
-				}{
-					Message: "No review cards left for this deck. Do some learning cards.",
-				}
-				tmpl, _ := template.ParseFiles("./templates/htmx/nocards.html")
+	switch request.Method {
+	case "POST":
+		processAction()
+	default:
+		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
+	}
+}
 
-				tmpl.Execute(writer, data)
-			}
+// AcceptAnswerHandler accepts a typed answer that was graded as wrong, for
+// example because of a typo or a synonym the card doesn't list yet.
+func (g *GormDB) AcceptAnswerHandler(writer http.ResponseWriter, request *http.Request) {
+	IDString := strings.TrimPrefix(request.URL.Path, "/accept-answer/")
+	id, _ := strconv.Atoi(IDString)
 
-		} else {
-			g.updateReviewCardByID(uint(card.ID), false)
+	processAccept := func() {
+		request.ParseForm()
 
-			data := struct {
-				Question      string
-				UserAnswer    string
-				CorrectAnswer string
-				Route         string
-			}{
-				Question:      card.Question,
-				UserAnswer:    userAnswer,
-				CorrectAnswer: card.Answer,
-				Route:         "/review-typing/" + IDString,
-			}
-			tmpl, _ := template.ParseFiles("./templates/htmx/wrong-answer.html")
+		userAnswer := strings.TrimSpace(request.FormValue("answer"))
+		var added string
+		if request.FormValue("add-answer") == "on" {
+			added = userAnswer
+		}
 
-			tmpl.Execute(writer, data)
+		card, err := g.acceptAnswer(uint(id), added)
+		if errors.Is(err, errNoReviewToRevert) {
+			http.Error(writer, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(writer, "Card not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
+		route := request.FormValue("route")
+		if !isLocalRoute(route) {
+			route = ""
+		}
+		data := struct {
+			Card       Card
+			UserAnswer string
+			Added      bool
+			Route      string
+		}{
+			Card:       card,
+			UserAnswer: userAnswer,
+			Added:      added != "",
+			Route:      route,
+		}
+		tmpl, _ := template.ParseFiles("./templates/htmx/answer-accepted.html")
+		tmpl.Execute(writer, data)
 	}
 
 	switch request.Method {
-	case "GET":
-		displayCards()
 	case "POST":
-		processAnswer()
+		processAccept()
 	default:
 		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
 	}
+}
 
+// isLocalRoute reports whether route is a path on this server, so that
+// redirecting to it cannot send the user elsewhere.
+func isLocalRoute(route string) bool {
+	return strings.HasPrefix(route, "/") && !strings.HasPrefix(route, "//")
 }
 
-func (g *GormDB) LearningHandler(writer http.ResponseWriter, request *http.Request) {
-	IDString := strings.TrimPrefix(request.URL.Path, "/learning/")
+// DeleteCardHandler deletes a card and offers to undo it in a toast. On the
+// deck page the card's row stays as a placeholder the undo restores it into,
+// in a study session the next card of the session route is loaded.
+func (g *GormDB) DeleteCardHandler(writer http.ResponseWriter, request *http.Request) {
+	IDString := strings.TrimPrefix(request.URL.Path, "/delete-card/")
 	id, _ := strconv.Atoi(IDString)
-	deck, _ := g.getDeckByID(uint(id))
-	cards, _ := g.getLearningCardsByDeckID(deck.ID)
 
-	cardAvailable := isCardsNotEmpty(cards)
+	processDelete := func() {
+		request.ParseForm()
 
-	displayDeckLearning := func() {
-		tmpl, _ := template.ParseFiles("./templates/learn.html", "./templates/navbar.html")
+		card, err := g.getCardByID(uint(id))
+		if err != nil {
+			http.Error(writer, "Card not found", http.StatusNotFound)
+			return
+		}
+		err = g.deleteCardByID(card)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		route := request.FormValue("route")
+		if !isLocalRoute(route) {
+			route = ""
+		}
 		data := struct {
-			Title         string
-			Deck          Deck
-			CardAvailable bool
+			Card  Card
+			Route string
 		}{
-			Title:         "Learning session for " + deck.Name,
-			Deck:          deck,
-			CardAvailable: cardAvailable,
+			Card:  card,
+			Route: route,
 		}
+		tmpl, _ := template.ParseFiles("./templates/htmx/card-deleted.html")
 		tmpl.Execute(writer, data)
 	}
 
 	switch request.Method {
-	case "GET":
-		displayDeckLearning()
+	case "POST":
+		processDelete()
 	default:
 		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
 	}
-
 }
-func (g *GormDB) ReviewHandler(writer http.ResponseWriter, request *http.Request) {
-	IDString := strings.TrimPrefix(request.URL.Path, "/review/")
+
+// RestoreCardHandler undoes the deletion of a card. An undo from the deck page
+// swaps the card's row back in, otherwise only the toast is updated.
+func (g *GormDB) RestoreCardHandler(writer http.ResponseWriter, request *http.Request) {
+	IDString := strings.TrimPrefix(request.URL.Path, "/restore-card/")
 	id, _ := strconv.Atoi(IDString)
-	deck, _ := g.getDeckByID(uint(id))
-	cards, _ := g.getDueReviewCardsByDeckID(deck.ID)
 
-	cardAvailable := isCardsNotEmpty(cards)
+	processRestore := func() {
+		card, err := g.restoreCardByID(uint(id))
+		if err != nil {
+			http.Error(writer, "Card not found", http.StatusNotFound)
+			return
+		}
 
-	displayDeckLearning := func() {
-		tmpl, _ := template.ParseFiles("./templates/review.html", "./templates/navbar.html")
 		data := struct {
-			Title         string
-			Deck          Deck
-			CardAvailable bool
+			Card Card
+			Row  bool
 		}{
-			Title:         "Review session for " + deck.Name,
-			Deck:          deck,
-			CardAvailable: cardAvailable,
+			Card: card,
+			Row:  request.Header.Get("HX-Target") == "card-"+IDString,
 		}
+		tmpl, _ := template.ParseFiles("./templates/htmx/card-restored.html", "./templates/htmx/card-row.html")
 		tmpl.Execute(writer, data)
 	}
 
 	switch request.Method {
-	case "GET":
-		displayDeckLearning()
+	case "POST":
+		processRestore()
 	default:
 		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
 	}
+}
+
+// deletedCardRetention is how long a deleted card can be restored before it
+// is purged.
+const deletedCardRetention = 7 * 24 * time.Hour
 
+// purgeDeletedCardsPeriodically purges the cards whose retention ran out once
+// an hour.
+func (g *GormDB) purgeDeletedCardsPeriodically() {
+	for {
+		purged, err := g.purgeDeletedCards(time.Now().UTC().Add(-deletedCardRetention))
+		if err != nil {
+			log.Print("failed to purge deleted cards: ", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d deleted cards", purged)
+		}
+		time.Sleep(time.Hour)
+	}
 }
 
-func (g *GormDB) CreateCardHandler(writer http.ResponseWriter, request *http.Request) {
-	displayForm := func() {
-		tmpl, _ := template.ParseFiles("./templates/create_card.html", "./templates/navbar.html")
+// SearchHandler searches the cards of every deck. Searches typed into the
+// page only replace the results.
+func (g *GormDB) SearchHandler(writer http.ResponseWriter, request *http.Request) {
+	displayResults := func() {
+		value := request.URL.Query().Get("q")
+
+		var cards []Card
+		var message string
+		if strings.TrimSpace(value) != "" {
+			search, err := parseSearchQuery(value, time.Now().UTC())
+			if err == nil {
+				cards, err = g.searchCards(search)
+			}
+			if err != nil {
+				message = err.Error()
+			} else if len(cards) == 0 {
+				message = "No cards found."
+			} else if len(cards) == maximumSearchResults {
+				message = fmt.Sprintf("Showing the first %d cards.", maximumSearchResults)
+			}
+		}
+
 		decks, _ := g.selectAllDecks()
 		data := struct {
 			Title   string
-			Heading string
+			Query   string
+			Cards   []Card
+			Paths   map[uint]string
 			Message string
-			Decks   []Deck
 		}{
-			Title:   "Card creation",
-			Heading: "Create a card",
-			Message: "A card needs a question and an answer",
-			Decks:   decks,
+			Title:   "Search",
+			Query:   value,
+			Cards:   cards,
+			Paths:   deckPaths(decks),
+			Message: message,
 		}
-		tmpl.Execute(writer, data)
-	}
-	processForm := func() {
-		request.ParseForm()
-
-		deckID, _ := strconv.ParseInt(request.FormValue("deck-id"), 10, 64)
-		question := request.FormValue("question")
-		answer := request.FormValue("answer")
-
-		t := time.Now().UTC().Format(time.RFC3339Nano)
-
-		var card Card
-		card.DeckID = uint(deckID)
-		card.Question = question
-		card.Answer = answer
-		card.CardCreated = string(t)
-		card.ReviewDueDate = string(t) //necessary to avoid a critical error when determining which card to show first for cards that have never been answered before.
-		g.createCard(card)
-
-		fmt.Fprintf(writer, "<div id='result'>Card with question '%s' and answer '%s' created successfully!</div>", question, answer)
 
+		if request.Header.Get("HX-Request") == "true" {
+			tmpl, _ := template.ParseFiles("./templates/htmx/search-results.html")
+			tmpl.Execute(writer, data)
+			return
+		}
+		tmpl, _ := template.ParseFiles("./templates/search.html", "./templates/navbar.html", "./templates/htmx/search-results.html")
+		tmpl.Execute(writer, data)
 	}
 
 	switch request.Method {
 	case "GET":
-		displayForm()
-	case "POST":
-		processForm()
+		displayResults()
 	default:
 		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
 	}
-
 }
 
-func (g *GormDB) DecksHandler(writer http.ResponseWriter, request *http.Request) {
-	displayDecks := func() {
-		tmpl, _ := template.ParseFiles("./templates/decks.html", "./templates/navbar.html")
+func (g *GormDB) LeechesHandler(writer http.ResponseWriter, request *http.Request) {
+	displayLeeches := func() {
+		tmpl, _ := template.ParseFiles("./templates/leeches.html", "./templates/navbar.html")
+		cards, _ := g.getLeechCards()
 		decks, _ := g.selectAllDecks()
+
+		deckNames := map[uint]string{}
+		for _, deck := range decks {
+			deckNames[deck.ID] = deck.Name
+		}
+
 		data := struct {
-			Title string
-			Decks []Deck
+			Title     string
+			Cards     []Card
+			DeckNames map[uint]string
 		}{
-			Title: "List of Decks",
-			Decks: decks,
+			Title:     "Leeches",
+			Cards:     cards,
+			DeckNames: deckNames,
 		}
 		tmpl.Execute(writer, data)
 	}
 
 	switch request.Method {
 	case "GET":
-		displayDecks()
+		displayLeeches()
 	default:
 		http.Error(writer, "Unsupported method", http.StatusMethodNotAllowed)
 	}
@@ -902,19 +3374,106 @@ func getNextEaseLevel(currentEase int, growthfactor float64) int {
 	return nextEase
 }
 
-func createNextReviewDueDate(ease int) string {
+// migrateEaseToSM2 derives the SM-2 state of review cards that were scheduled
+// by doubling only. Their ease doubles with every correct review and half of it
+// is the interval that was last used, so log2 of the ease is the repetition count.
+func migrateEaseToSM2(db *gorm.DB) error {
+	var cards []Card
+	err := db.Where("stage = ?", "review").Find(&cards).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, card := range cards {
+			ease := math.Max(float64(card.Ease), 1)
+			err := tx.Model(&card).Updates(map[string]interface{}{
+				"ease_factor": 2.5,
+				"repetitions": uint(math.Log2(ease)),
+				"interval":    time.Duration(math.Max(ease/2, 1)) * 24 * time.Hour,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// legacyCardDates holds the card dates of a database that stored them as
+// RFC3339 strings.
+type legacyCardDates struct {
+	ID             uint
+	CardCreated    string
+	LastReviewDate string
+	ReviewDueDate  string
+	BuriedUntil    string
+}
+
+// readLegacyCardDates returns the string dates of every card if the cards
+// table still stores them as text. It must run before AutoMigrate changes
+// the column types.
+func readLegacyCardDates(db *gorm.DB) ([]legacyCardDates, error) {
+	if !db.Migrator().HasTable(&Card{}) {
+		return nil, nil
+	}
+	columnTypes, err := db.Migrator().ColumnTypes(&Card{})
+	if err != nil {
+		return nil, err
+	}
+
+	var columns []string
+	legacy := false
+	for _, columnType := range columnTypes {
+		switch columnType.Name() {
+		case "card_created", "last_review_date", "review_due_date", "buried_until":
+			columns = append(columns, columnType.Name())
+			if strings.EqualFold(columnType.DatabaseTypeName(), "text") {
+				legacy = true
+			}
+		}
+	}
+	if !legacy {
+		return nil, nil
+	}
 
-	t := time.Now().UTC()
-	hours := ease * 24
-	duration := time.Duration(hours) * time.Hour
+	var dates []legacyCardDates
+	err = db.Table("cards").Select(append([]string{"id"}, columns...)).Scan(&dates).Error
+	return dates, err
+}
 
-	t = t.Add(duration)
+// migrateCardDates stores the string dates read by readLegacyCardDates as
+// timestamps. Cards with a missing or malformed due date become due now.
+func migrateCardDates(db *gorm.DB, dates []legacyCardDates) error {
+	now := time.Now().UTC()
+	parse := func(value string, fallback time.Time) time.Time {
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return fallback
+		}
+		return t.UTC()
+	}
 
-	formattedTime := t.Format(time.RFC3339Nano)
-	return string(formattedTime)
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, date := range dates {
+			err := tx.Model(&Card{}).Where("id = ?", date.ID).Updates(map[string]interface{}{
+				"card_created":     parse(date.CardCreated, time.Time{}),
+				"last_review_date": parse(date.LastReviewDate, time.Time{}),
+				"review_due_date":  parse(date.ReviewDueDate, now),
+				"buried_until":     parse(date.BuriedUntil, time.Time{}),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func main() {
+	optimizeFSRS := flag.Bool("optimize-fsrs", false, "fit the FSRS weights of every deck to its review history and exit")
+	flag.Parse()
+
 	fmt.Println(startMessage())
 
 	db, err := gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
@@ -924,7 +3483,48 @@ func main() {
 
 	gormDB := &GormDB{db: db}
 
-	db.AutoMigrate(&Deck{}, &Card{})
+	migrateEase := !db.Migrator().HasColumn(&Card{}, "ease_factor")
+
+	legacyDates, err := readLegacyCardDates(db)
+	if err != nil {
+		log.Fatal("failed to read card dates: ", err)
+	}
+
+	db.AutoMigrate(&Deck{}, &Card{}, &Tag{}, &ReviewLog{})
+
+	if len(legacyDates) > 0 {
+		err = migrateCardDates(db, legacyDates)
+		if err != nil {
+			log.Fatal("failed to migrate card dates: ", err)
+		}
+	}
+
+	if migrateEase {
+		err = migrateEaseToSM2(db)
+		if err != nil {
+			log.Fatal("failed to migrate card ease: ", err)
+		}
+	}
+
+	// the cards_fts table may exist without FTS5 if the database was used
+	// by a build with it, so only rebuilding the index proves it works
+	err = createSearchIndex(db)
+	if err == nil {
+		err = indexCards(db, nil)
+	}
+	if err != nil {
+		log.Print("Search falls back to LIKE without the FTS5 index: ", err)
+	} else {
+		gormDB.fts = true
+	}
+
+	if *optimizeFSRS {
+		err = gormDB.optimizeFSRSDecks()
+		if err != nil {
+			log.Fatal("failed to optimize FSRS weights: ", err)
+		}
+		return
+	}
 
 	http.HandleFunc("/", HomeHandler)
 	http.HandleFunc("/create-deck", gormDB.CreateDeckHandler)
@@ -932,13 +3532,34 @@ func main() {
 	http.HandleFunc("/learning/", gormDB.LearningHandler)
 	http.HandleFunc("/review/", gormDB.ReviewHandler)
 	http.HandleFunc("/deck/", gormDB.DeckHandler)
+	http.HandleFunc("/deck-options/", gormDB.DeckOptionsHandler)
+	http.HandleFunc("/manage-deck/", gormDB.ManageDeckHandler)
+	http.HandleFunc("/rename-deck/", gormDB.DeckActionHandler)
+	http.HandleFunc("/move-deck/", gormDB.DeckActionHandler)
+	http.HandleFunc("/duplicate-deck/", gormDB.DeckActionHandler)
+	http.HandleFunc("/merge-deck/", gormDB.DeckActionHandler)
+	http.HandleFunc("/delete-deck/", gormDB.DeckActionHandler)
 	http.HandleFunc("/create-card", gormDB.CreateCardHandler)
+	http.HandleFunc("/edit-card/", gormDB.EditCardHandler)
+	http.HandleFunc("/card-row/", gormDB.CardRowHandler)
+	http.HandleFunc("/delete-card/", gormDB.DeleteCardHandler)
+	http.HandleFunc("/restore-card/", gormDB.RestoreCardHandler)
+	http.HandleFunc("/bulk-cards/", gormDB.BulkCardsHandler)
+	http.HandleFunc("/accept-answer/", gormDB.AcceptAnswerHandler)
+	http.HandleFunc("/search", gormDB.SearchHandler)
+	http.HandleFunc("/leeches", gormDB.LeechesHandler)
+	http.HandleFunc("/suspend-card/", gormDB.CardActionHandler)
+	http.HandleFunc("/unsuspend-card/", gormDB.CardActionHandler)
+	http.HandleFunc("/bury-card/", gormDB.CardActionHandler)
+	http.HandleFunc("/unbury-card/", gormDB.CardActionHandler)
 	http.HandleFunc("/learning-typing/", gormDB.LearningTypingHandler)
 	http.HandleFunc("/learning-multiple-choice/", gormDB.LearningMultipleChoiceHandler)
 	http.HandleFunc("/review-multiple-choice/", gormDB.ReviewMultipleChoiceHandler)
 	http.HandleFunc("/review-typing/", gormDB.ReviewTypingHandler)
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
 
+	go gormDB.purgeDeletedCardsPeriodically()
+
 	fmt.Println("Server starting at :8080")
 	http.ListenAndServe(":8080", nil)
 
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Grade is how well the user answered a card.
+type Grade int
+
+const (
+	GradeAgain Grade = iota
+	GradeHard
+	GradeGood
+	GradeEasy
+)
+
+func (g Grade) String() string {
+	switch g {
+	case GradeAgain:
+		return "Again"
+	case GradeHard:
+		return "Hard"
+	case GradeGood:
+		return "Good"
+	case GradeEasy:
+		return "Easy"
+	}
+	return "Grade(" + strconv.Itoa(int(g)) + ")"
+}
+
+func parseGrade(value string) (Grade, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return GradeAgain, err
+	}
+	grade := Grade(n)
+	if grade < GradeAgain || grade > GradeEasy {
+		return GradeAgain, fmt.Errorf("invalid grade %d", n)
+	}
+	return grade, nil
+}
+
+// grades are the grades a correct answer can get, in the order of the grading
+// buttons. A wrong answer is always graded Again.
+var grades = []Grade{GradeAgain, GradeHard, GradeGood, GradeEasy}
+
+// Scheduler decides when a card is shown next. Given a card and the grade of
+// the answer it returns the card with its next stage, ease, interval and due
+// date filled in. Answer counters and the review date are handled by the caller.
+// Schedulers that don't tell Hard and Easy reviews apart treat them as Good.
+type Scheduler interface {
+	Schedule(card Card, grade Grade, now time.Time) Card
+}
+
+// schedulers holds every algorithm a deck can pick, keyed by the name stored
+// in Deck.Scheduler.
+var schedulers = map[string]func(deck Deck) Scheduler{
+	"doubling": func(deck Deck) Scheduler { return DoublingScheduler{Steps: learningStepsFor(deck)} },
+	"sm2":      func(deck Deck) Scheduler { return SM2Scheduler{Steps: learningStepsFor(deck)} },
+	"fsrs":     newFSRSScheduler,
+	"leitner": func(deck Deck) Scheduler {
+		return LeitnerScheduler{Steps: learningStepsFor(deck), Boxes: deck.LeitnerBoxes}
+	},
+}
+
+const defaultScheduler = "doubling"
+
+func schedulerFor(deck Deck) Scheduler {
+	newScheduler, ok := schedulers[deck.Scheduler]
+	if !ok {
+		newScheduler = schedulers[defaultScheduler]
+	}
+	return newScheduler(deck)
+}
+
+func schedulerNames() []string {
+	names := make([]string, 0, len(schedulers))
+	for name := range schedulers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LearningSteps are the delays a deck uses for cards that are not in review.
+// A learning card is shown again after each learning step and graduates on
+// the first correct answer after the last one, with the graduating interval,
+// or straight away with the easy interval when answered Easy.
+//
+// A review card that is answered wrong lapses into relearning. It comes back
+// after the first relearning step and returns to review on the first correct
+// answer after the last one, with its old interval cut to LapseFactor.
+type LearningSteps struct {
+	Learning    []time.Duration
+	Relearning  []time.Duration
+	Graduating  time.Duration
+	Easy        time.Duration
+	LapseFactor float64
+}
+
+var defaultLearningSteps = LearningSteps{
+	Learning:    []time.Duration{time.Minute},
+	Relearning:  []time.Duration{time.Minute},
+	Graduating:  24 * time.Hour,
+	Easy:        4 * 24 * time.Hour,
+	LapseFactor: 0,
+}
+
+// learningStepsFor reads the learning settings of a deck, falling back to the
+// defaults for anything that does not parse.
+func learningStepsFor(deck Deck) LearningSteps {
+	steps := defaultLearningSteps
+
+	learning, err := parseSteps(deck.LearningSteps)
+	if err == nil {
+		steps.Learning = learning
+	}
+	relearning, err := parseSteps(deck.RelearningSteps)
+	if err == nil {
+		steps.Relearning = relearning
+	}
+	if deck.GraduatingInterval > 0 {
+		steps.Graduating = time.Duration(deck.GraduatingInterval) * 24 * time.Hour
+	}
+	if deck.EasyInterval > 0 {
+		steps.Easy = time.Duration(deck.EasyInterval) * 24 * time.Hour
+	}
+	steps.LapseFactor = float64(deck.LapseIntervalPercent) / 100
+	return steps
+}
+
+// learn moves a learning card along the learning steps and reports whether it
+// graduated. A graduated card gets the graduating or easy interval, the
+// scheduler may replace it with one of its own.
+func (s LearningSteps) learn(card Card, grade Grade) (Card, bool) {
+	switch grade {
+	case GradeAgain:
+		card.Step = 0
+		card.Interval = s.step(s.Learning, 0)
+		return card, false
+	case GradeHard:
+		// Hard repeats the current step, which is the first one until a
+		// step is done
+		if card.Step == 0 {
+			card.Interval = s.step(s.Learning, 0)
+			return card, false
+		}
+		card.Interval = s.step(s.Learning, card.Step-1)
+		return card, false
+	case GradeEasy:
+		card.Step = 0
+		card.Interval = s.Easy
+		return card, true
+	}
+
+	if int(card.Step) < len(s.Learning) {
+		card.Interval = s.Learning[card.Step]
+		card.Step++
+		return card, false
+	}
+	card.Step = 0
+	card.Interval = s.Graduating
+	return card, true
+}
+
+// lapse sends a review card that was answered wrong to relearning. The given
+// interval is kept for when the card returns to review and the returned delay
+// is how long until the card is shown again. Without relearning steps the card
+// stays in review and simply waits for that interval. Counting the lapse is
+// left to the scheduler.
+func (s LearningSteps) lapse(card Card, interval time.Duration) (Card, time.Duration) {
+	card.Interval = interval
+	if len(s.Relearning) == 0 {
+		return card, interval
+	}
+	card.Stage = "relearning"
+	card.Step = 1
+	return card, s.Relearning[0]
+}
+
+// relearn moves a relearning card along the relearning steps. It returns the
+// delay until the card is shown again and whether it is back in review, in
+// which case the delay is the interval kept when it lapsed.
+func (s LearningSteps) relearn(card Card, grade Grade) (Card, time.Duration, bool) {
+	switch grade {
+	case GradeAgain:
+		card.Step = 1
+		return card, s.step(s.Relearning, 0), false
+	case GradeHard:
+		if card.Step == 0 {
+			return card, s.step(s.Relearning, 0), false
+		}
+		return card, s.step(s.Relearning, card.Step-1), false
+	case GradeEasy:
+		card.Step = 0
+		card.Stage = "review"
+		return card, card.Interval, true
+	}
+
+	if int(card.Step) < len(s.Relearning) {
+		delay := s.Relearning[card.Step]
+		card.Step++
+		return card, delay, false
+	}
+	card.Step = 0
+	card.Stage = "review"
+	return card, card.Interval, true
+}
+
+// shrink cuts the interval of a lapsed card to the lapse factor, keeping at least a day.
+func (s LearningSteps) shrink(interval time.Duration) time.Duration {
+	day := 24 * time.Hour
+	shrunk := time.Duration(float64(interval) * s.LapseFactor).Round(day)
+	if shrunk < day {
+		return day
+	}
+	return shrunk
+}
+
+func (s LearningSteps) step(steps []time.Duration, index uint) time.Duration {
+	if int(index) < len(steps) {
+		return steps[index]
+	}
+	if len(steps) > 0 {
+		return steps[len(steps)-1]
+	}
+	return s.Graduating
+}
+
+// parseSteps reads a space separated list of durations such as "1m 10m 1h 1d".
+func parseSteps(value string) ([]time.Duration, error) {
+	var steps []time.Duration
+	for _, field := range strings.Fields(value) {
+		var step time.Duration
+		var err error
+		if days, ok := strings.CutSuffix(field, "d"); ok {
+			var n int
+			n, err = strconv.Atoi(days)
+			step = time.Duration(n) * 24 * time.Hour
+		} else {
+			step, err = time.ParseDuration(field)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid step %q", field)
+		}
+		if step <= 0 {
+			return nil, fmt.Errorf("step %q must be positive", field)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// DoublingScheduler is the original linguatron algorithm. Every correct
+// review doubles the ease and the ease is the interval in days.
+type DoublingScheduler struct {
+	Steps LearningSteps
+}
+
+func (s DoublingScheduler) Schedule(card Card, grade Grade, now time.Time) Card {
+	delay := card.Interval
+
+	switch card.Stage {
+	case "learning":
+		var graduated bool
+		card, graduated = s.Steps.learn(card, grade)
+		if grade == GradeAgain {
+			card.Ease = 1
+		}
+		if graduated {
+			card.Stage = "review"
+			card.Ease = doubledEase(card.Interval)
+		}
+		delay = card.Interval
+	case "relearning":
+		var back bool
+		card, delay, back = s.Steps.relearn(card, grade)
+		if back {
+			card.Ease = doubledEase(card.Interval)
+		}
+	default:
+		if grade == GradeAgain {
+			// a card whose ease is already back to 1 has lapsed before and
+			// is not counted again
+			if card.Ease != 1 {
+				card.Lapses++
+			}
+			card, delay = s.Steps.lapse(card, s.Steps.shrink(card.Interval))
+			card.Ease = doubledEase(card.Interval)
+		} else {
+			card.Interval = time.Duration(card.Ease) * 24 * time.Hour
+			card.Ease = uint(getNextEaseLevel(int(card.Ease), 2))
+			delay = card.Interval
+		}
+	}
+
+	card.ReviewDueDate = now.Add(delay)
+	return card
+}
+
+// doubledEase is the ease that makes the next review interval twice the given one.
+func doubledEase(interval time.Duration) uint {
+	return uint(getNextEaseLevel(int(math.Ceil(interval.Hours()/24)), 2))
+}
+
+const minimumEaseFactor = 1.3
+
+// SM2Scheduler implements the SuperMemo 2 algorithm. Each card keeps its own
+// ease factor, the number of successful repetitions in a row and the last
+// interval.
+type SM2Scheduler struct {
+	Steps LearningSteps
+}
+
+func (s SM2Scheduler) Schedule(card Card, grade Grade, now time.Time) Card {
+	day := 24 * time.Hour
+
+	switch card.Stage {
+	case "learning":
+		var graduated bool
+		card, graduated = s.Steps.learn(card, grade)
+		if graduated {
+			card.Stage = "review"
+			card.Repetitions = 1
+		}
+		card.ReviewDueDate = now.Add(card.Interval)
+		return card
+	case "relearning":
+		var delay time.Duration
+		var back bool
+		card, delay, back = s.Steps.relearn(card, grade)
+		if back {
+			card.Repetitions = 1
+		}
+		card.ReviewDueDate = now.Add(delay)
+		return card
+	}
+
+	if card.EaseFactor < minimumEaseFactor {
+		card.EaseFactor = minimumEaseFactor
+	}
+
+	delay := card.Interval
+	if grade == GradeAgain {
+		card.Repetitions = 0
+		card.Lapses++
+		card, delay = s.Steps.lapse(card, s.Steps.shrink(card.Interval))
+	} else {
+		switch card.Repetitions {
+		case 0:
+			card.Interval = day
+		case 1:
+			card.Interval = 6 * day
+		default:
+			days := math.Round(card.Interval.Hours() / 24 * card.EaseFactor)
+			card.Interval = time.Duration(math.Max(days, 1)) * day
+		}
+		card.Repetitions++
+		delay = card.Interval
+	}
+	card.EaseFactor = nextEaseFactor(card.EaseFactor, sm2Quality(grade))
+
+	card.ReviewDueDate = now.Add(delay)
+	return card
+}
+
+// sm2Quality maps a grade onto the 0-5 response quality scale of SM-2.
+func sm2Quality(grade Grade) float64 {
+	switch grade {
+	case GradeHard:
+		return 3
+	case GradeGood:
+		return 4
+	case GradeEasy:
+		return 5
+	}
+	return 2
+}
+
+func nextEaseFactor(easeFactor float64, quality float64) float64 {
+	easeFactor += 0.1 - (5-quality)*(0.08+(5-quality)*0.02)
+	return math.Max(easeFactor, minimumEaseFactor)
+}
+
+// Interval in days of each Leitner box.
+var leitnerIntervals = []uint{1, 2, 4, 8, 16, 32, 64}
+
+const (
+	minimumLeitnerBoxes = 5
+	maximumLeitnerBoxes = 7
+)
+
+// LeitnerScheduler moves cards through a fixed number of boxes. A correct
+// answer moves a card up one box and a wrong one sends it back to the first,
+// and every box has a fixed interval. Learning cards enter the first box when
+// they graduate.
+type LeitnerScheduler struct {
+	Steps LearningSteps
+	Boxes uint
+}
+
+func (s LeitnerScheduler) Schedule(card Card, grade Grade, now time.Time) Card {
+	boxes := clampLeitnerBoxes(s.Boxes)
+	firstBox := time.Duration(leitnerIntervals[0]) * 24 * time.Hour
+	var delay time.Duration
+
+	switch {
+	case card.Stage == "learning":
+		var graduated bool
+		card, graduated = s.Steps.learn(card, grade)
+		if graduated {
+			card.Stage = "review"
+			card.Box = 1
+			card.Interval = firstBox
+		}
+		delay = card.Interval
+	case card.Stage == "relearning":
+		card, delay, _ = s.Steps.relearn(card, grade)
+	case grade == GradeAgain:
+		card.Box = 1
+		card.Lapses++
+		card, delay = s.Steps.lapse(card, firstBox)
+	default:
+		if card.Box == 0 {
+			card.Box = 1
+		} else if card.Box < boxes {
+			card.Box++
+		}
+		card.Interval = time.Duration(leitnerIntervals[card.Box-1]) * 24 * time.Hour
+		delay = card.Interval
+	}
+
+	card.ReviewDueDate = now.Add(delay)
+	return card
+}
+
+func clampLeitnerBoxes(boxes uint) uint {
+	if boxes < minimumLeitnerBoxes {
+		return minimumLeitnerBoxes
+	}
+	if boxes > maximumLeitnerBoxes {
+		return maximumLeitnerBoxes
+	}
+	return boxes
+}
+
+// LeitnerBox is a box of a Leitner deck and the number of cards in it.
+type LeitnerBox struct {
+	Number uint
+	Cards  uint
+}
+
+// leitnerBoxes returns how many review cards sit in each box. Cards that were
+// reviewed before the deck switched to Leitner count towards the first box.
+func leitnerBoxes(cards []Card, boxes uint) []LeitnerBox {
+	counts := make([]LeitnerBox, clampLeitnerBoxes(boxes))
+	for i := range counts {
+		counts[i].Number = uint(i + 1)
+	}
+	for _, card := range cards {
+		if card.Stage == "learning" {
+			continue
+		}
+		box := card.Box
+		if box < 1 {
+			box = 1
+		}
+		if box > uint(len(counts)) {
+			box = uint(len(counts))
+		}
+		counts[box-1].Cards++
+	}
+	return counts
+}
+
+// fuzzesIntervals reports whether the review intervals of a deck may be
+// fuzzed and balanced. Leitner boxes have fixed intervals, so only the
+// schedulers that compute intervals qualify.
+func fuzzesIntervals(deck Deck) bool {
+	return deck.Scheduler != "leitner"
+}
+
+// fuzzRange returns the first and last day a review interval may be moved to
+// when fuzzed by the given percentage. Intervals under two days are not fuzzed
+// and every other interval may move by at least a day.
+func fuzzRange(interval time.Duration, percent uint) (int, int) {
+	days := int(math.Round(interval.Hours() / 24))
+	if percent == 0 || days < 2 {
+		return days, days
+	}
+	delta := int(math.Round(float64(days) * float64(percent) / 100))
+	if delta < 1 {
+		delta = 1
+	}
+	return max(days-delta, 2), days + delta
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDoublingSchedulerGraduatesAfterTwoCorrectAnswers(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	card := Card{Stage: "learning", Ease: 1}
+	scheduler := DoublingScheduler{Steps: defaultLearningSteps}
+
+	card = scheduler.Schedule(card, GradeGood, now)
+	if card.Stage != "learning" || card.Interval != time.Minute {
+		t.Fatalf("after first answer got stage %q interval %v", card.Stage, card.Interval)
+	}
+
+	card = scheduler.Schedule(card, GradeGood, now)
+	if card.Stage != "review" || card.Interval != 24*time.Hour {
+		t.Fatalf("after second answer got stage %q interval %v", card.Stage, card.Interval)
+	}
+
+	card = scheduler.Schedule(card, GradeAgain, now)
+	if card.Stage != "relearning" || card.Lapses != 1 {
+		t.Fatalf("after lapse got stage %q lapses %d", card.Stage, card.Lapses)
+	}
+
+	card = scheduler.Schedule(card, GradeGood, now)
+	if card.Stage != "review" || card.Interval != 24*time.Hour {
+		t.Errorf("after relearning got stage %q interval %v", card.Stage, card.Interval)
+	}
+}
+
+func TestSM2SchedulerIntervals(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	card := Card{Stage: "learning", EaseFactor: 2.5}
+	scheduler := SM2Scheduler{Steps: defaultLearningSteps}
+
+	for i := 0; i < 4; i++ {
+		card = scheduler.Schedule(card, GradeGood, now)
+	}
+
+	if card.Interval != 15*day {
+		t.Errorf("got interval %v want %v", card.Interval, 15*day)
+	}
+
+	card = scheduler.Schedule(card, GradeHard, now)
+	if card.EaseFactor != 2.36 {
+		t.Errorf("got ease factor %v want 2.36", card.EaseFactor)
+	}
+
+	card = scheduler.Schedule(card, GradeAgain, now)
+	if card.Repetitions != 0 || card.Lapses != 1 || card.Stage != "relearning" {
+		t.Errorf("got repetitions %d lapses %d stage %q want 0 1 relearning", card.Repetitions, card.Lapses, card.Stage)
+	}
+}
+
+func TestLeitnerSchedulerMovesCardsBetweenBoxes(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	card := Card{Stage: "learning"}
+	scheduler := LeitnerScheduler{Steps: defaultLearningSteps, Boxes: 5}
+
+	for i := 0; i < 8; i++ {
+		card = scheduler.Schedule(card, GradeGood, now)
+	}
+	if card.Box != 5 || card.Interval != 16*24*time.Hour {
+		t.Fatalf("got box %d interval %v want 5 384h", card.Box, card.Interval)
+	}
+
+	card = scheduler.Schedule(card, GradeAgain, now)
+	if card.Box != 1 || card.Lapses != 1 || card.Stage != "relearning" {
+		t.Errorf("got box %d lapses %d want 1 1", card.Box, card.Lapses)
+	}
+}
+
+func TestLearningStepsGraduation(t *testing.T) {
+	steps, err := parseSteps("1m 10m 1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	learning := LearningSteps{Learning: steps, Graduating: 3 * 24 * time.Hour}
+	card := Card{Stage: "learning"}
+
+	var graduated bool
+	for _, want := range []time.Duration{time.Minute, 10 * time.Minute, 24 * time.Hour} {
+		card, graduated = learning.learn(card, GradeGood)
+		if graduated || card.Interval != want {
+			t.Fatalf("got interval %v graduated %v want %v", card.Interval, graduated, want)
+		}
+	}
+
+	card, graduated = learning.learn(card, GradeGood)
+	if !graduated || card.Interval != 3*24*time.Hour {
+		t.Errorf("got interval %v graduated %v want 72h true", card.Interval, graduated)
+	}
+}
+
+func TestHardRepeatsTheCurrentStep(t *testing.T) {
+	steps, err := parseSteps("1m 10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	learning := LearningSteps{Learning: steps, Relearning: steps, Graduating: 24 * time.Hour}
+
+	card, graduated := learning.learn(Card{Stage: "learning"}, GradeHard)
+	if graduated || card.Step != 0 || card.Interval != time.Minute {
+		t.Errorf("new card got step %d interval %v graduated %v want 0 1m false", card.Step, card.Interval, graduated)
+	}
+	card, _ = learning.learn(Card{Stage: "learning", Step: 1}, GradeHard)
+	if card.Step != 1 || card.Interval != time.Minute {
+		t.Errorf("card after first step got step %d interval %v want 1 1m", card.Step, card.Interval)
+	}
+
+	card, delay, back := learning.relearn(Card{Stage: "relearning"}, GradeHard)
+	if back || card.Step != 0 || delay != time.Minute {
+		t.Errorf("relearning card got step %d delay %v back %v want 0 1m false", card.Step, delay, back)
+	}
+	card, delay, _ = learning.relearn(Card{Stage: "relearning", Step: 2}, GradeHard)
+	if card.Step != 2 || delay != 10*time.Minute {
+		t.Errorf("relearning card after second step got step %d delay %v want 2 10m", card.Step, delay)
+	}
+}
+
+func TestLapseKeepsShareOfOldInterval(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	steps := defaultLearningSteps
+	steps.Relearning = []time.Duration{10 * time.Minute}
+	steps.LapseFactor = 0.5
+	scheduler := SM2Scheduler{Steps: steps}
+	card := Card{Stage: "review", EaseFactor: 2.5, Repetitions: 3, Interval: 20 * 24 * time.Hour}
+
+	card = scheduler.Schedule(card, GradeAgain, now)
+	want := now.Add(10 * time.Minute)
+	if !card.ReviewDueDate.Equal(want) {
+		t.Errorf("got due %v want %v", card.ReviewDueDate, want)
+	}
+
+	card = scheduler.Schedule(card, GradeGood, now)
+	if card.Stage != "review" || card.Interval != 10*24*time.Hour {
+		t.Errorf("got stage %q interval %v want review 240h", card.Stage, card.Interval)
+	}
+}
+
+func TestDoublingSchedulerCountsLapsesOfCardsAboveFirstEase(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	scheduler := DoublingScheduler{Steps: defaultLearningSteps}
+
+	card := scheduler.Schedule(Card{Stage: "review", Ease: 4, Interval: 48 * time.Hour}, GradeAgain, now)
+	if card.Lapses != 1 {
+		t.Errorf("card with ease 4 got %d lapses want 1", card.Lapses)
+	}
+
+	card = scheduler.Schedule(Card{Stage: "review", Ease: 1, Lapses: 1, Interval: 24 * time.Hour}, GradeAgain, now)
+	if card.Lapses != 1 {
+		t.Errorf("card with ease 1 got %d lapses want 1", card.Lapses)
+	}
+}
+
+func TestFuzzRange(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		interval    time.Duration
+		percent     uint
+		first, last int
+	}{
+		{day, 5, 1, 1},
+		{2 * day, 5, 2, 3},
+		{10 * day, 5, 9, 11},
+		{100 * day, 5, 95, 105},
+		{100 * day, 0, 100, 100},
+	}
+
+	for _, test := range tests {
+		first, last := fuzzRange(test.interval, test.percent)
+		if first != test.first || last != test.last {
+			t.Errorf("fuzzRange(%v, %d) got %d-%d want %d-%d", test.interval, test.percent, first, last, test.first, test.last)
+		}
+	}
+}
+
+func TestLeitnerIntervalsAreNotFuzzed(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	deck := Deck{Scheduler: "leitner", LeitnerBoxes: 7, FuzzPercent: 25, LoadBalance: true}
+	scheduler := schedulerFor(deck)
+	card := Card{Stage: "review", Box: 1, Interval: 24 * time.Hour}
+
+	for box := 2; box <= 7; box++ {
+		// load balancing would need a database, so the card must not be fuzzed at all
+		card = fuzzCard(nil, scheduler.Schedule(card, GradeGood, now), deck, now)
+		want := time.Duration(leitnerIntervals[box-1]) * 24 * time.Hour
+		if card.Interval != want || !card.ReviewDueDate.Equal(now.Add(want)) {
+			t.Errorf("box %d got interval %v due %v want %v", box, card.Interval, card.ReviewDueDate, want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SearchQuery is a parsed search like `perro deck:Spanish tag:food due:<today`.
+// Terms are matched against the question, answer, notes and tags of a card,
+// the filters narrow the results down. A zero DueFrom or DueUntil leaves that
+// side of the due date open.
+type SearchQuery struct {
+	Terms    []string
+	Deck     string
+	Stage    string
+	Tags     []string
+	DueFrom  time.Time
+	DueUntil time.Time
+}
+
+// parseSearchQuery splits a search into terms and filters. Values with spaces
+// can be quoted, as in deck:"Spanish verbs". Words that look like a filter
+// but name none are searched for as terms.
+func parseSearchQuery(value string, now time.Time) (SearchQuery, error) {
+	var query SearchQuery
+	for _, token := range splitSearchTokens(value) {
+		key, filter, ok := strings.Cut(token, ":")
+		if !ok || filter == "" {
+			query.Terms = append(query.Terms, token)
+			continue
+		}
+
+		switch strings.ToLower(key) {
+		case "deck":
+			query.Deck = filter
+		case "stage":
+			query.Stage = strings.ToLower(filter)
+		case "tag":
+			query.Tags = append(query.Tags, strings.ToLower(filter))
+		case "due":
+			from, until, err := parseDueFilter(filter, now)
+			if err != nil {
+				return query, err
+			}
+			query.DueFrom, query.DueUntil = from, until
+		default:
+			query.Terms = append(query.Terms, token)
+		}
+	}
+	return query, nil
+}
+
+// splitSearchTokens splits a search at spaces outside of double quotes and
+// drops the quotes.
+func splitSearchTokens(value string) []string {
+	var tokens []string
+	var token strings.Builder
+	quoted := false
+	for _, r := range value {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+		default:
+			token.WriteRune(r)
+		}
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens
+}
+
+// parseDueFilter turns the value of a due: filter into a time range. The value
+// is an optional comparison (<, <=, >, >=) followed by a day: today, tomorrow,
+// yesterday or a date like 2024-05-01. Days start at midnight UTC. Without a
+// comparison the range is the day itself.
+func parseDueFilter(value string, now time.Time) (time.Time, time.Time, error) {
+	var comparison string
+	for _, prefix := range []string{"<=", ">=", "<", ">"} {
+		if strings.HasPrefix(value, prefix) {
+			comparison = prefix
+			value = strings.TrimPrefix(value, prefix)
+			break
+		}
+	}
+
+	today := now.UTC().Truncate(24 * time.Hour)
+	var start time.Time
+	switch strings.ToLower(value) {
+	case "today":
+		start = today
+	case "tomorrow":
+		start = today.AddDate(0, 0, 1)
+	case "yesterday":
+		start = today.AddDate(0, 0, -1)
+	default:
+		day, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("unknown due date %q, use today, tomorrow, yesterday or a date like 2024-05-01", value)
+		}
+		start = day
+	}
+	end := start.AddDate(0, 0, 1)
+
+	switch comparison {
+	case "<":
+		return time.Time{}, start, nil
+	case "<=":
+		return time.Time{}, end, nil
+	case ">":
+		return end, time.Time{}, nil
+	case ">=":
+		return start, time.Time{}, nil
+	default:
+		return start, end, nil
+	}
+}
+
+// createSearchIndex creates the FTS5 table that holds the searchable text of
+// every card under the card's ID. It fails if SQLite was built without FTS5,
+// which needs the sqlite_fts5 build tag.
+func createSearchIndex(db *gorm.DB) error {
+	return db.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS cards_fts USING fts5(question, answer, notes, tags)").Error
+}
+
+// indexCards updates the search index entries of the cards with the given
+// IDs, or rebuilds the whole index if ids is nil.
+func indexCards(db *gorm.DB, ids []uint) error {
+	var err error
+	if ids != nil {
+		err = db.Exec("DELETE FROM cards_fts WHERE rowid IN ?", ids).Error
+	} else {
+		err = db.Exec("DELETE FROM cards_fts").Error
+	}
+	if err != nil {
+		return err
+	}
+
+	insert := `INSERT INTO cards_fts(rowid, question, answer, notes, tags)
+		SELECT cards.id, cards.question, cards.answer, cards.notes,
+			COALESCE((SELECT group_concat(tags.name, ' ') FROM card_tags JOIN tags ON tags.id = card_tags.tag_id WHERE card_tags.card_id = cards.id), '')
+		FROM cards`
+	if ids != nil {
+		return db.Exec(insert+" WHERE cards.id IN ?", ids).Error
+	}
+	return db.Exec(insert).Error
+}
+
+// ftsMatch builds an FTS5 query that matches cards containing every term,
+// each one as a prefix.
+func ftsMatch(terms []string) string {
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+	return strings.Join(phrases, " ")
+}
+
+// likeContains builds a LIKE pattern that matches values containing term.
+// Wildcards in term match themselves, with backslash as the escape character.
+func likeContains(term string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+	return "%" + escaped + "%"
+}
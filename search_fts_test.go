@@ -0,0 +1,104 @@
+//go:build sqlite_fts5
+
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestSearchDB returns a GormDB on an empty in-memory database with the
+// FTS5 search index.
+func newTestSearchDB(t *testing.T) *GormDB {
+	t.Helper()
+	g := newTestDB(t)
+	err := createSearchIndex(g.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.fts = true
+	return g
+}
+
+func searchQuestions(t *testing.T, g *GormDB, terms ...string) []string {
+	t.Helper()
+	cards, err := g.searchCards(SearchQuery{Terms: terms})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cardQuestions(cards)
+}
+
+func TestSearchIndex(t *testing.T) {
+	g := newTestSearchDB(t)
+	deck := createTestDeck(t, g, "Spanish")
+	now := time.Now().UTC()
+
+	err := g.createCard(Card{DeckID: deck.ID, Question: "el perro", Answer: "the dog", CardCreated: now, ReviewDueDate: now, Tags: []Tag{{Name: "animals"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.createCard(Card{DeckID: deck.ID, Question: "el gato", Answer: "the cat", Notes: "a pet", CardCreated: now, ReviewDueDate: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		terms []string
+		want  []string
+	}{
+		{[]string{"perr"}, []string{"el perro"}},
+		{[]string{"animals"}, []string{"el perro"}},
+		{[]string{"pet"}, []string{"el gato"}},
+		{[]string{"the"}, []string{"el gato", "el perro"}},
+		{[]string{"the", "cat"}, []string{"el gato"}},
+		{[]string{`say "hi"`}, []string{}},
+	}
+	for _, test := range tests {
+		if got := searchQuestions(t, g, test.terms...); !slices.Equal(got, test.want) {
+			t.Errorf("search for %q = %q, want %q", test.terms, got, test.want)
+		}
+	}
+
+	var perro Card
+	g.db.Preload("Tags").Where("question = ?", "el perro").First(&perro)
+	perro.Answer = "the hound"
+	err = g.updateCard(perro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := searchQuestions(t, g, "dog"); len(got) != 0 {
+		t.Errorf("search for the old answer = %q, want nothing", got)
+	}
+	if got := searchQuestions(t, g, "hound"); !slices.Equal(got, []string{"el perro"}) {
+		t.Errorf("search for the new answer = %q, want el perro", got)
+	}
+
+	err = g.deleteCardByID(perro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := searchQuestions(t, g, "the"); !slices.Equal(got, []string{"el gato"}) {
+		t.Errorf("search after deleting = %q, want el gato", got)
+	}
+	g.db.Unscoped().Model(&perro).Update("deleted_at", now.Add(-deletedCardRetention-time.Hour))
+	_, err = g.purgeDeletedCards(now.Add(-deletedCardRetention))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indexed int64
+	g.db.Raw("SELECT count(*) FROM cards_fts").Scan(&indexed)
+	if indexed != 1 {
+		t.Errorf("search index holds %d cards after purging, want 1", indexed)
+	}
+
+	// rebuilding the index gives the same results
+	err = indexCards(g.db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := searchQuestions(t, g, "pet"); !slices.Equal(got, []string{"el gato"}) {
+		t.Errorf("search after rebuilding = %q, want el gato", got)
+	}
+}
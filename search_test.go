@@ -0,0 +1,69 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	now := time.Date(2024, 5, 10, 15, 30, 0, 0, time.UTC)
+	today := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	query, err := parseSearchQuery(`perro deck:"Spanish verbs" stage:Review tag:food due:<today note:x`, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(query.Terms, []string{"perro", "note:x"}) {
+		t.Errorf("got terms %v", query.Terms)
+	}
+	if query.Deck != "Spanish verbs" || query.Stage != "review" || !slices.Equal(query.Tags, []string{"food"}) {
+		t.Errorf("got filters %+v", query)
+	}
+	if !query.DueFrom.IsZero() || !query.DueUntil.Equal(today) {
+		t.Errorf("got due from %v until %v want until %v", query.DueFrom, query.DueUntil, today)
+	}
+
+	_, err = parseSearchQuery("due:<someday", now)
+	if err == nil {
+		t.Errorf("expected an error for an unknown due date")
+	}
+}
+
+func TestParseDueFilter(t *testing.T) {
+	now := time.Date(2024, 5, 10, 15, 30, 0, 0, time.UTC)
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		value       string
+		from, until time.Time
+	}{
+		{"today", day(10), day(11)},
+		{"<=today", time.Time{}, day(11)},
+		{">tomorrow", day(12), time.Time{}},
+		{">=2024-05-01", day(1), time.Time{}},
+	}
+
+	for _, test := range tests {
+		from, until, err := parseDueFilter(test.value, now)
+		if err != nil || !from.Equal(test.from) || !until.Equal(test.until) {
+			t.Errorf("%s: got %v %v %v want %v %v", test.value, from, until, err, test.from, test.until)
+		}
+	}
+}
+
+func TestFTSMatch(t *testing.T) {
+	got := ftsMatch([]string{"perro", `say "hi"`})
+	want := `"perro"* "say ""hi"""*`
+	if got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+}
+
+func TestLikeContains(t *testing.T) {
+	got := likeContains(`50%_off\`)
+	want := `%50\%\_off\\%`
+	if got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"net/url"
+	"reflect"
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestGetNextEaseLevel(t *testing.T) {
@@ -12,3 +16,209 @@ func TestGetNextEaseLevel(t *testing.T) {
 		t.Errorf("got %d want %d", got, want)
 	}
 }
+
+func TestMarkLeech(t *testing.T) {
+	deck := Deck{LeechThreshold: 3, LeechAction: "suspend"}
+
+	card := markLeech(Card{Lapses: 2}, deck)
+	if card.Leech || card.Suspended {
+		t.Errorf("card below the threshold was marked as leech")
+	}
+
+	card = markLeech(Card{Lapses: 3}, deck)
+	if !card.Leech || !card.Suspended {
+		t.Errorf("got leech %v suspended %v want true true", card.Leech, card.Suspended)
+	}
+}
+
+func TestResetScheduling(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	card := Card{Question: "perro", Answer: "dog", Correct: 4, Stage: "review", Lapses: 2, EaseFactor: 1.8, Interval: 72 * time.Hour, Leech: true}
+
+	card = resetScheduling(card, now)
+	if card.Stage != "learning" || card.Lapses != 0 || card.EaseFactor != 2.5 || card.Interval != 0 || card.Leech {
+		t.Errorf("scheduling was not reset: %+v", card)
+	}
+	if card.Question != "perro" || card.Answer != "dog" || card.Correct != 4 {
+		t.Errorf("content or counts changed: %+v", card)
+	}
+	if !card.ReviewDueDate.Equal(now) {
+		t.Errorf("got due %v want %v", card.ReviewDueDate, now)
+	}
+}
+
+func TestResolveDuplicates(t *testing.T) {
+	source := []Card{
+		{ID: 1, Question: "perro", Interval: 96 * time.Hour},
+		{ID: 2, Question: "gato"},
+	}
+	target := []Card{
+		{ID: 3, Question: " Perro", Interval: 24 * time.Hour},
+	}
+
+	tests := []struct {
+		resolution string
+		move       []uint
+		remove     []uint
+	}{
+		{"keep-both", []uint{1, 2}, []uint{}},
+		{"keep-target", []uint{2}, []uint{1}},
+		{"keep-source", []uint{1, 2}, []uint{3}},
+		{"keep-further", []uint{1, 2}, []uint{3}},
+	}
+
+	for _, test := range tests {
+		move, remove := resolveDuplicates(source, target, test.resolution)
+		if !slices.Equal(cardIDs(move), test.move) || !slices.Equal(cardIDs(remove), test.remove) {
+			t.Errorf("%s: got move %v remove %v want %v %v", test.resolution, cardIDs(move), cardIDs(remove), test.move, test.remove)
+		}
+	}
+
+	source = append(source, Card{ID: 4, Question: "perro ", Interval: 48 * time.Hour})
+	for _, resolution := range []string{"keep-source", "keep-further"} {
+		_, remove := resolveDuplicates(source, target, resolution)
+		if !slices.Equal(cardIDs(remove), []uint{3}) {
+			t.Errorf("%s: got remove %v want [3]", resolution, cardIDs(remove))
+		}
+	}
+}
+
+func TestDeckTree(t *testing.T) {
+	decks := []Deck{
+		{ID: 1, Name: "Spanish"},
+		{ID: 2, Name: "Verbs", ParentID: 1},
+		{ID: 3, Name: "Irregular", ParentID: 2},
+		{ID: 4, Name: "French"},
+	}
+
+	if got := subtreeDeckIDs(decks, 1); !slices.Equal(got, []uint{1, 2, 3}) {
+		t.Errorf("got subtree %v want [1 2 3]", got)
+	}
+	if got := deckPaths(decks)[3]; got != "Spanish::Verbs::Irregular" {
+		t.Errorf("got path %q", got)
+	}
+
+	tree := buildDeckTree(decks, map[uint]int64{1: 1, 3: 2}, map[uint]int64{2: 5, 4: 1})
+	if len(tree) != 2 || tree[0].Due != 3 || tree[0].New != 5 || tree[1].New != 1 {
+		t.Errorf("got tree %+v", tree)
+	}
+	if verbs := tree[0].Children[0]; verbs.Due != 2 || len(verbs.Children) != 1 {
+		t.Errorf("got subdeck %+v", verbs)
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	got := parseTags(" Food, chapter-3  food\tverbs,")
+	want := []string{"food", "chapter-3", "verbs"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+func TestTagChips(t *testing.T) {
+	chips := tagChips([]Tag{{Name: "food"}, {Name: "verbs"}}, []string{"food"})
+	if !chips[0].Selected || chips[0].Query != "" {
+		t.Errorf("selected chip got %+v", chips[0])
+	}
+	if chips[1].Selected || chips[1].Query != "?tag=food&tag=verbs" {
+		t.Errorf("unselected chip got %+v", chips[1])
+	}
+}
+
+func TestParseCardIDs(t *testing.T) {
+	got := parseCardIDs([]string{"3", "1, 2", "x", "0", "3", ""})
+	want := []uint{3, 1, 2}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseCardIDs = %v, want %v", got, want)
+	}
+}
+
+func TestCardListOptions(t *testing.T) {
+	query, _ := url.ParseQuery("tag=food&stage=review&sort=lapses&order=desc&page=3")
+	options := parseCardListOptions(query)
+	want := CardListOptions{Tags: []string{"food"}, Stage: "review", Sort: "lapses", Descending: true, Page: 3}
+	if !slices.Equal(options.Tags, want.Tags) || options.Stage != want.Stage || options.Sort != want.Sort || options.Descending != want.Descending || options.Page != want.Page {
+		t.Errorf("parseCardListOptions = %+v, want %+v", options, want)
+	}
+	if got := options.Query(); got != "?order=desc&page=3&sort=lapses&stage=review&tag=food" {
+		t.Errorf("Query = %q", got)
+	}
+
+	query, _ = url.ParseQuery("stage=nope&sort=nope&page=-1")
+	options = parseCardListOptions(query)
+	if options.Stage != "" || options.Sort != "due" || options.Page != 1 {
+		t.Errorf("parseCardListOptions with invalid values = %+v", options)
+	}
+	if got := options.Query(); got != "" {
+		t.Errorf("Query with defaults = %q, want empty", got)
+	}
+
+	page := DeckPage{List: CardListOptions{Sort: "due", Page: 2}}
+	if got := page.SortQuery("due"); got != "?order=desc" {
+		t.Errorf("SortQuery on the current sort = %q", got)
+	}
+	if got := page.SortQuery("lapses"); got != "?sort=lapses" {
+		t.Errorf("SortQuery on another sort = %q", got)
+	}
+}
+
+func TestReverseCard(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	card := Card{ID: 7, DeckID: 2, Question: "perro", Answer: "dog", Notes: "animal", Stage: "review", Interval: 48 * time.Hour, Lapses: 2}
+
+	reverse := reverseCard(card, now)
+	if reverse.Question != "dog" || reverse.Answer != "perro" || reverse.Notes != "animal" || reverse.DeckID != 2 {
+		t.Errorf("reverseCard content = %+v", reverse)
+	}
+	if reverse.SiblingID != 7 || reverse.ID != 0 {
+		t.Errorf("reverseCard IDs = %d, sibling %d, want 0, sibling 7", reverse.ID, reverse.SiblingID)
+	}
+	if reverse.Stage != "learning" || reverse.Interval != 0 || reverse.Lapses != 0 || !reverse.ReviewDueDate.Equal(now) {
+		t.Errorf("reverseCard did not start over: %+v", reverse)
+	}
+}
+
+func TestSchedulingStateRestore(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	card := Card{
+		ID: 3, Question: "perro", Answer: "dog",
+		Stage: "review", Lapses: 1, Ease: 4, EaseFactor: 2.3, Repetitions: 5, Interval: 96 * time.Hour,
+		Stability: 7.5, Difficulty: 4.2, Box: 3, Step: 1, Correct: 6, Incorrect: 2,
+		LastReviewDate: now.Add(-96 * time.Hour), ReviewDueDate: now,
+	}
+	before := schedulingStateOf(card)
+
+	lapsed := resetScheduling(card, now)
+	lapsed.Leech, lapsed.Suspended, lapsed.Incorrect = true, true, 3
+	lapsed.Answer = "dog; hound"
+
+	restored := before.restore(lapsed)
+	want := card
+	want.Answer = "dog; hound"
+	if !reflect.DeepEqual(restored, want) {
+		t.Errorf("restore = %+v, want %+v", restored, want)
+	}
+}
+
+func TestPostedGrade(t *testing.T) {
+	card, other := Card{ID: 1}, Card{ID: 2}
+	tests := []struct {
+		value   string
+		current Card
+		correct bool
+		want    Grade
+		wantErr bool
+	}{
+		{"1", card, true, GradeHard, false},
+		{"3", card, true, GradeEasy, false},
+		{"2", other, true, GradeAgain, true},
+		{"2", card, false, GradeAgain, true},
+		{"4", card, true, GradeAgain, true},
+	}
+	for _, test := range tests {
+		grade, err := postedGrade(test.value, card, test.current, test.correct)
+		if grade != test.want || (err != nil) != test.wantErr {
+			t.Errorf("postedGrade(%q, current %d, correct %v) = %v, %v", test.value, test.current.ID, test.correct, grade, err)
+		}
+	}
+}